@@ -14,11 +14,17 @@ type CustomRouter struct{}
 func init() {
 	router.AddCompile(`welcome/index`, "welcome/index")
 	router.AddCompile(`welcome/version/(\w+)/(\w+)`, "welcome/version/$1/$2")
+
+	//路由分组 v2/xxx 映射到命名空间为v2的控制器
+	v2 := router.Group("v2")
+	v2.SetNamespace("v2")
+	v2.SetDefaultClassMethod("welcome", "index")
 }
 
 // appCheck工具可自动配置 路由与控制器的映射关系 该部分可由bin下的appCheck工具自动生成
 func init() {
 	//仅提供对内的访问
 	handler.AddCompile("welcome", func() control.Control { return &controller.Welcome{} })
+	handler.AddCompile("v2.welcome", func() control.Control { return &controller.Welcome{} })
 
 }
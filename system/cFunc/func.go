@@ -3,6 +3,7 @@ package cFunc
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/tls"
@@ -167,23 +168,37 @@ func LoadConfig(fi string, st interface{}) (string, error) {
 
 // SignPost 加密发送post请求到接口
 func SignPost(domain string, key string, secret string, control string, method string, data map[string]string) (string, error) {
+	return SignPostType(SignMd5, domain, key, secret, control, method, data)
+}
+
+// SignPostType 按指定的签名方式 加密发送post请求到接口
+// rsa ed25519时secret为私钥pem
+func SignPostType(signType string, domain string, key string, secret string, control string, method string, data map[string]string) (string, error) {
 	param, _ := jsoniter.Marshal(data)
 	type Param struct {
-		AppKey  string `json:"app_key"`
-		Control string `json:"control"`
-		Method  string `json:"method"`
-		Ip      string `json:"ip"`
-		Sign    string `json:"sign"`
-		Param   string `json:"param"`
+		AppKey    string `json:"app_key"`
+		Control   string `json:"control"`
+		Method    string `json:"method"`
+		Ip        string `json:"ip"`
+		Timestamp int64  `json:"timestamp"`
+		Nonce     string `json:"nonce"`
+		Sign      string `json:"sign"`
+		Param     string `json:"param"`
 	}
 	d := Param{
-		AppKey:  key,
-		Control: control,
-		Ip:      LocalIPV4(),
-		Method:  method,
-		Param:   string(param),
+		AppKey:    key,
+		Control:   control,
+		Ip:        LocalIPV4(),
+		Method:    method,
+		Timestamp: time.Now().Unix(),
+		Nonce:     Nonce(),
+		Param:     string(param),
+	}
+	sign, err := Sign(signType, secret, ParamSignStr(d.AppKey, d.Control, d.Ip, d.Method, d.Nonce, d.Param, d.Timestamp))
+	if err != nil {
+		return "", err
 	}
-	d.Sign = Md5("app_key=" + d.AppKey + "&control=" + d.Control + "&ip=" + d.Ip + "&" + "method=" + d.Method + "&param=" + url.QueryEscape(string(param)) + secret)
+	d.Sign = sign
 
 	pJson, err := jsoniter.Marshal(d)
 	if err != nil {
@@ -194,8 +209,42 @@ func SignPost(domain string, key string, secret string, control string, method s
 	return GetPost("POST", domain+control+"/"+method, dt, nil, nil)
 }
 
+// SignJsonPost 以header签名的方式发送json数据到接口
+// path 为接口路径 如 rpc 或 welcome/index
+func SignJsonPost(domain string, key string, secret string, path string, data interface{}) (string, error) {
+	return SignJsonPostType(SignMd5, domain, key, secret, path, data)
+}
+
+// SignJsonPostType 按指定的签名方式 以header签名发送json数据到接口
+// rsa ed25519时secret为私钥pem
+func SignJsonPostType(signType string, domain string, key string, secret string, path string, data interface{}) (string, error) {
+	body, err := jsoniter.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(domain + path)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := SignHeader(signType, key, secret, http.MethodPost, u.Path, u.RawQuery, body)
+	if err != nil {
+		return "", err
+	}
+	head["Content-Type"] = "application/json;charset=UTF-8"
+
+	return PostBody(u.String(), body, head)
+}
+
 // GetPost 发送get 或 post请求 获取数据
 func GetPost(method string, sUrl string, data map[string]string, head map[string]string, cookie []*http.Cookie) (string, error) {
+	return GetPostCtx(context.Background(), method, sUrl, data, head, cookie)
+}
+
+// GetPostCtx 携带context发送get 或 post请求 context取消或超时时请求随之取消
+// ctx可直接传入控制器中的Ctx
+func GetPostCtx(ctx context.Context, method string, sUrl string, data map[string]string, head map[string]string, cookie []*http.Cookie) (string, error) {
 	//请求体数据
 	var postBody *strings.Reader
 	if data != nil {
@@ -208,11 +257,31 @@ func GetPost(method string, sUrl string, data map[string]string, head map[string
 		postBody = strings.NewReader("")
 	}
 
-	req, err := http.NewRequest(method, sUrl, postBody)
+	req, err := http.NewRequestWithContext(ctx, method, sUrl, postBody)
+	if err != nil {
+		return "", err
+	}
+
+	return sendRequest(req, head, cookie)
+}
+
+// PostBody 发送post请求 body为原始数据 如json数据
+func PostBody(sUrl string, body []byte, head map[string]string) (string, error) {
+	return PostBodyCtx(context.Background(), sUrl, body, head)
+}
+
+// PostBodyCtx 携带context发送post请求 body为原始数据 如json数据
+func PostBodyCtx(ctx context.Context, sUrl string, body []byte, head map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", sUrl, bytes.NewReader(body))
 	if err != nil {
 		return "", err
 	}
 
+	return sendRequest(req, head, nil)
+}
+
+// 设置header cookie后发送请求 获取数据
+func sendRequest(req *http.Request, head map[string]string, cookie []*http.Cookie) (string, error) {
 	if _, ok := head["User-Agent"]; !ok {
 		req.Header.Add("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/77.0.3865.120 Safari/537.36")
 	}
@@ -0,0 +1,266 @@
+package cFunc
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 支持的签名方式
+const (
+	SignMd5        = "md5"         //md5(待签名字符串 + secret)
+	SignSha256     = "sha256"      //sha256(待签名字符串 + secret)
+	SignHmacSha256 = "hmac-sha256" //hmac-sha256(secret, 待签名字符串)
+	SignRsa        = "rsa"         //私钥签名 公钥验签 PKCS1v15 + sha256 结果为base64
+	SignEd25519    = "ed25519"     //私钥签名 公钥验签 结果为base64
+)
+
+// 通过header传递签名信息时使用的字段
+const (
+	HeaderAppKey    = "X-App-Key"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSign      = "X-Sign"
+)
+
+// ParamSignStr 生成param参数签名的待签名字符串
+// nonce timestamp 为空时不参与签名 兼容未携带防重放参数的调用方
+func ParamSignStr(appKey string, control string, ip string, method string, nonce string, param string, timestamp int64) string {
+	str := "app_key=" + appKey + "&" +
+		"control=" + control + "&" +
+		"ip=" + ip + "&" +
+		"method=" + method + "&"
+	if nonce != "" {
+		str += "nonce=" + nonce + "&"
+	}
+	str += "param=" + url.QueryEscape(param)
+	if timestamp != 0 {
+		str += "&timestamp=" + strconv.FormatInt(timestamp, 10)
+	}
+
+	return str
+}
+
+// HeaderSignStr 生成header签名的待签名字符串
+// body为请求的原始body数据 取md5后参与签名 json数据、文件上传、rpc调用均可签名
+// method path query 为请求方式、请求路径和原始查询字符串
+func HeaderSignStr(appKey string, timestamp string, nonce string, method string, path string, query string, body []byte) string {
+	return "app_key=" + appKey + "&" +
+		"body=" + Md5(string(body)) + "&" +
+		"method=" + strings.ToUpper(method) + "&" +
+		"nonce=" + nonce + "&" +
+		"path=" + url.QueryEscape(path) + "&" +
+		"query=" + url.QueryEscape(query) + "&" +
+		"timestamp=" + timestamp
+}
+
+// SignHeader 生成签名header 可直接传入GetPost等请求函数的head参数
+// signType为签名方式 rsa ed25519时secret为私钥pem method为请求方式 如POST
+func SignHeader(signType string, key string, secret string, method string, path string, query string, body []byte) (map[string]string, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := Nonce()
+	str := HeaderSignStr(key, timestamp, nonce, method, path, query, body)
+
+	sign, err := Sign(signType, secret, str)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		HeaderAppKey:    key,
+		HeaderTimestamp: timestamp,
+		HeaderNonce:     nonce,
+		HeaderSign:      sign,
+	}, nil
+}
+
+// Sign 按签名方式生成签名
+// signType为空时使用md5
+// rsa ed25519时secret为私钥pem 支持PKCS1 PKCS8格式
+func Sign(signType string, secret string, str string) (string, error) {
+	switch signType {
+	case "", SignMd5:
+		return Md5(str + secret), nil
+	case SignSha256:
+		return Sha256(str + secret), nil
+	case SignHmacSha256:
+		return HmacSha256(secret, str), nil
+	case SignRsa:
+		key, err := parsePrivateKey(secret)
+		if err != nil {
+			return "", err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return "", errors.New("私钥不是rsa格式")
+		}
+		h := sha256.Sum256([]byte(str))
+		b, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, h[:])
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	case SignEd25519:
+		key, err := parsePrivateKey(secret)
+		if err != nil {
+			return "", err
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return "", errors.New("私钥不是ed25519格式")
+		}
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(edKey, []byte(str))), nil
+	default:
+		return "", errors.New("不支持的签名方式:" + signType)
+	}
+}
+
+// VerifySign 按签名方式校验签名
+// signType为空时使用md5
+// rsa ed25519时secret为公钥pem 支持PKIX PKCS1格式
+func VerifySign(signType string, secret string, str string, sign string) error {
+	return VerifyKeySign("", signType, secret, str, sign)
+}
+
+// VerifyKeySign 按签名方式校验app_key的签名
+// 解析后的公钥按appKey缓存 配置中的公钥变更时替换 appKey为空时不缓存
+func VerifyKeySign(appKey string, signType string, secret string, str string, sign string) error {
+	switch signType {
+	case "", SignMd5, SignSha256, SignHmacSha256:
+		s, err := Sign(signType, secret, str)
+		if err != nil {
+			return err
+		}
+		if !hmac.Equal([]byte(s), []byte(sign)) {
+			return errors.New("签名错误")
+		}
+		return nil
+	case SignRsa, SignEd25519:
+		b, err := base64.StdEncoding.DecodeString(sign)
+		if err != nil {
+			return errors.New("签名错误")
+		}
+		key, err := publicKey(appKey, secret)
+		if err != nil {
+			return err
+		}
+
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			if signType != SignRsa {
+				return errors.New("公钥与签名方式不匹配")
+			}
+			h := sha256.Sum256([]byte(str))
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], b) != nil {
+				return errors.New("签名错误")
+			}
+		case ed25519.PublicKey:
+			if signType != SignEd25519 {
+				return errors.New("公钥与签名方式不匹配")
+			}
+			if !ed25519.Verify(k, []byte(str), b) {
+				return errors.New("签名错误")
+			}
+		default:
+			return errors.New("不支持的公钥格式")
+		}
+		return nil
+	default:
+		return errors.New("不支持的签名方式:" + signType)
+	}
+}
+
+// Sha256 返回sha256的十六进制字符串
+func Sha256(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// HmacSha256 返回hmac-sha256的十六进制字符串
+func HmacSha256(secret string, s string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 已解析的公钥 按appKey缓存 避免每次验签重复解析pem
+var publicKeys sync.Map
+
+type cachedKey struct {
+	pem string
+	key interface{}
+}
+
+// 取appKey对应的公钥 pem与缓存的不一致时重新解析并替换
+func publicKey(appKey string, pemStr string) (interface{}, error) {
+	if appKey != "" {
+		if v, ok := publicKeys.Load(appKey); ok && v.(*cachedKey).pem == pemStr {
+			return v.(*cachedKey).key, nil
+		}
+	}
+
+	key, err := parsePublicKey(pemStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if appKey != "" {
+		publicKeys.Store(appKey, &cachedKey{pem: pemStr, key: key})
+	}
+	return key, nil
+}
+
+// 解析pem格式的公钥
+func parsePublicKey(pemStr string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, errors.New("无效的公钥")
+	}
+
+	var key interface{}
+	var err error
+	if block.Type == "RSA PUBLIC KEY" {
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// 解析pem格式的私钥
+func parsePrivateKey(pemStr string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, errors.New("无效的私钥")
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+// Nonce 生成32位随机字符串
+func Nonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
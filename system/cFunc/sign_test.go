@@ -0,0 +1,160 @@
+package cFunc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+// 生成测试使用的密钥对 返回私钥与公钥的pem
+func testKeys(t *testing.T) (rsaPri, rsaPub, rsaPub1, edPri, edPub string) {
+	t.Helper()
+
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPri = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rk)}))
+	b, _ := x509.MarshalPKIXPublicKey(&rk.PublicKey)
+	rsaPub = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+	rsaPub1 = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rk.PublicKey)}))
+
+	pub, pri, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = x509.MarshalPKCS8PrivateKey(pri)
+	edPri = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}))
+	b, _ = x509.MarshalPKIXPublicKey(pub)
+	edPub = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+
+	return
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaPri, rsaPub, rsaPub1, edPri, edPub := testKeys(t)
+
+	tests := []struct {
+		name     string
+		signType string
+		secret   string //签名使用的秘钥
+		verify   string //验签使用的秘钥
+	}{
+		{"default", "", "secret", "secret"},
+		{"md5", SignMd5, "secret", "secret"},
+		{"sha256", SignSha256, "secret", "secret"},
+		{"hmac-sha256", SignHmacSha256, "secret", "secret"},
+		{"rsa pkix", SignRsa, rsaPri, rsaPub},
+		{"rsa pkcs1", SignRsa, rsaPri, rsaPub1},
+		{"ed25519", SignEd25519, edPri, edPub},
+	}
+
+	str := HeaderSignStr("key", "1700000000", "abc", "POST", "/rpc", "a=1", []byte(`{"id":1}`))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sign, err := Sign(tt.signType, tt.secret, str)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = VerifySign(tt.signType, tt.verify, str, sign); err != nil {
+				t.Errorf("verify: %v", err)
+			}
+
+			if err = VerifySign(tt.signType, tt.verify, str+"&x=1", sign); err == nil {
+				t.Error("tampered string passed")
+			}
+
+			if err = VerifySign(tt.signType, tt.verify, str, sign[:len(sign)-4]+"AAAA"); err == nil {
+				t.Error("tampered sign passed")
+			}
+		})
+	}
+
+	//秘钥错误
+	sign, _ := Sign(SignHmacSha256, "secret", str)
+	if VerifySign(SignHmacSha256, "other", str, sign) == nil {
+		t.Error("hmac passed with wrong secret")
+	}
+
+	//公钥与签名方式不匹配
+	sign, _ = Sign(SignEd25519, edPri, str)
+	if VerifySign(SignRsa, edPub, str, sign) == nil {
+		t.Error("ed25519 key passed as rsa")
+	}
+
+	if _, err := Sign("sha1", "secret", str); err == nil {
+		t.Error("unsupported sign type accepted")
+	}
+	if VerifySign("sha1", "secret", str, sign) == nil {
+		t.Error("unsupported verify type accepted")
+	}
+}
+
+func TestHeaderSignStr(t *testing.T) {
+	base := HeaderSignStr("key", "1700000000", "abc", "post", "/rpc", "a=1", []byte("body"))
+	if !strings.Contains(base, "&method=POST&") {
+		t.Errorf("method not normalized: %s", base)
+	}
+
+	//任意部分修改后待签名字符串均不同
+	changed := []string{
+		HeaderSignStr("key2", "1700000000", "abc", "POST", "/rpc", "a=1", []byte("body")),
+		HeaderSignStr("key", "1700000001", "abc", "POST", "/rpc", "a=1", []byte("body")),
+		HeaderSignStr("key", "1700000000", "abd", "POST", "/rpc", "a=1", []byte("body")),
+		HeaderSignStr("key", "1700000000", "abc", "GET", "/rpc", "a=1", []byte("body")),
+		HeaderSignStr("key", "1700000000", "abc", "POST", "/rpc2", "a=1", []byte("body")),
+		HeaderSignStr("key", "1700000000", "abc", "POST", "/rpc", "a=2", []byte("body")),
+		HeaderSignStr("key", "1700000000", "abc", "POST", "/rpc", "a=1", []byte("body2")),
+	}
+	for _, v := range changed {
+		if v == base {
+			t.Errorf("sign string not changed: %s", v)
+		}
+	}
+}
+
+func TestSignHeader(t *testing.T) {
+	head, err := SignHeader(SignHmacSha256, "key", "secret", "POST", "/rpc", "", []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	str := HeaderSignStr(head[HeaderAppKey], head[HeaderTimestamp], head[HeaderNonce], "POST", "/rpc", "", []byte("{}"))
+	if err = VerifySign(SignHmacSha256, "secret", str, head[HeaderSign]); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+
+	//请求方式不同时验签失败
+	str = HeaderSignStr(head[HeaderAppKey], head[HeaderTimestamp], head[HeaderNonce], "GET", "/rpc", "", []byte("{}"))
+	if VerifySign(SignHmacSha256, "secret", str, head[HeaderSign]) == nil {
+		t.Error("sign passed with another method")
+	}
+}
+
+func TestVerifyKeySignCache(t *testing.T) {
+	_, _, _, edPri, edPub := testKeys(t)
+	_, _, _, edPri2, edPub2 := testKeys(t)
+
+	sign, _ := Sign(SignEd25519, edPri, "str")
+	if err := VerifyKeySign("cache", SignEd25519, edPub, "str", sign); err != nil {
+		t.Fatal(err)
+	}
+
+	//同一app_key的公钥变更后 使用新公钥验签
+	if VerifyKeySign("cache", SignEd25519, edPub2, "str", sign) == nil {
+		t.Error("old key still cached")
+	}
+	sign2, _ := Sign(SignEd25519, edPri2, "str")
+	if err := VerifyKeySign("cache", SignEd25519, edPub2, "str", sign2); err != nil {
+		t.Errorf("new key: %v", err)
+	}
+
+	if VerifyKeySign("cache", SignEd25519, "invalid", "str", sign2) == nil {
+		t.Error("invalid pem accepted")
+	}
+}
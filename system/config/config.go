@@ -5,14 +5,23 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/solaa51/zoo/system/cFunc"
 	"github.com/solaa51/zoo/system/library/fileMonitor"
+	"github.com/solaa51/zoo/system/library/limiter"
 	"github.com/solaa51/zoo/system/library/snowflake"
 	"github.com/solaa51/zoo/system/mLog"
 	"github.com/solaa51/zoo/system/path"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-var config *Config
+var (
+	config     atomic.Value //*Config 重新加载时整体替换 读取中的请求继续使用之前的配置
+	configOnce sync.Once
+	configDir  string //SetDir指定的配置目录
+)
+
+const configFileName = "app.toml"
 
 // Http http服务配置
 type Http struct {
@@ -21,6 +30,43 @@ type Http struct {
 	HTTPS    bool   `toml:"https"` //是否开启https服务
 	HTTPSKEY string `toml:"httpsKey"`
 	HTTPSPEM string `toml:"httpsPem"`
+	RpcPath  string `toml:"rpcPath"` //json-rpc服务的访问路径 为空则不开启
+
+	HttpsPort      string `toml:"httpsPort"`      //https监听端口 http与https同时开启时使用 为空则只在PORT上提供https服务
+	Redirect       bool   `toml:"redirect"`       //http请求重定向到https
+	Hsts           int64  `toml:"hsts"`           //https返回Strict-Transport-Security的max-age 单位秒 为0则不返回
+	HstsSubDomains bool   `toml:"hstsSubDomains"` //hsts是否包含子域名
+	Certs          []Cert `toml:"certs"`          //其他域名的证书 按SNI选择 未匹配时使用httpsPem httpsKey
+	ClientCa       string `toml:"clientCa"`       //mTLS 校验客户端证书的CA文件 可包含多个证书
+	ClientAuth     string `toml:"clientAuth"`     //mTLS 客户端证书校验方式 require握手时必须提供 optional提供时校验 为空则不开启
+
+	Timeout     int64  `toml:"timeout"`     //请求处理超时时间 单位秒 为0则使用默认的10秒
+	TimeoutBody string `toml:"timeoutBody"` //超时返回的内容
+	MaxBodySize int64  `toml:"maxBodySize"` //请求body的最大长度 单位MB 为0则使用默认的32MB
+}
+
+// mTLS 客户端证书校验方式
+const (
+	ClientAuthRequire  = "require"  //tls握手时必须提供CA签发的客户端证书
+	ClientAuthOptional = "optional" //提供了则校验 未在ignoreMtlsCheck中的class必须提供
+)
+
+// Cert https证书 文件修改后自动重新加载
+type Cert struct {
+	Pem string `toml:"pem"`
+	Key string `toml:"key"`
+}
+
+// Response JsonReturn等返回数据的字段名称 默认为 msg ret data
+type Response struct {
+	Msg  string `toml:"msg"`
+	Ret  string `toml:"ret"`
+	Data string `toml:"data"`
+}
+
+// WebSocket websocket配置
+type WebSocket struct {
+	Origins []string `toml:"origins"` //允许跨域连接的来源 如 https://a.com *.a.com 为*则不限制 同域名始终允许
 }
 
 // StaticConfig 静态文件匹配配置
@@ -49,7 +95,7 @@ type Config struct {
 	configPath string //程序配置文件所在目录
 
 	//**********以下为可实时更新项***********//
-	Encrypt          Encrypt         `toml:"encrypt"`         //http请求加密处理 秘钥支持实时更新 当前仅支持md5,加密方式不支持其他
+	Encrypt          Encrypt         `toml:"encrypt"`         //http请求加密处理 秘钥支持实时更新 每个key可单独指定签名方式
 	Env              string          `toml:"env"`             //发布dev   测试test
 	IgnoreSignCheck  string          `toml:"ignoreSignCheck"` //忽略签名检查的类
 	ignoresSignClass map[string]bool //map存储忽略签名检查的类 方便查询
@@ -58,16 +104,50 @@ type Config struct {
 	ipPass           map[string]bool //map存储 指定允许通过的IP列表 方便查询
 	IgnoreIpCheck    string          `toml:"ignoreIpCheck"` //忽略IP检查的类
 	ignoreIpClass    map[string]bool //map存储忽略IP检查的类 方便查询
+	IgnoreMtlsCheck  string          `toml:"ignoreMtlsCheck"` //不需要客户端证书的类
+	ignoreMtlsClass  map[string]bool //map存储不需要客户端证书的类 方便查询
 	StaticFiles      []StaticConfig  `toml:"staticFiles"`
+	Limiter          []limiter.Rule  `toml:"limiter"`   //限流规则
+	Response         Response        `toml:"response"`  //返回数据的字段名称
+	WebSocket        WebSocket       `toml:"websocket"` //websocket配置
 	//**********允许实时更新项***********//
 }
 
+// 配置文件更新后的回调
+var (
+	reloadMu    sync.Mutex
+	reloadFuncs []func(*Config)
+)
+
+// OnReload 注册配置文件更新后的回调 用于刷新依赖配置的组件
+func OnReload(f func(*Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	reloadFuncs = append(reloadFuncs, f)
+}
+
+// SetDir 指定配置文件所在的目录 需在首次调用Info之前设置
+// 为空则从程序所在目录向上查找configs目录 测试时可指定包内的配置目录
+func SetDir(dir string) {
+	if dir != "" && !strings.HasSuffix(dir, string(os.PathSeparator)) {
+		dir += string(os.PathSeparator)
+	}
+
+	configDir = dir
+}
+
+// Info 获取配置信息 首次调用时加载配置文件并开始监控文件修改
+// 导入包时不读取配置文件 配置文件更新后返回新的配置 不要长期持有返回值
 func Info() *Config {
-	return config
+	configOnce.Do(load)
+	return config.Load().(*Config)
 }
 
 // IgnoreSign 是否忽略签名检查
 func IgnoreSign(className string) bool {
+	config := Info()
+
 	//如果为测试环境 直接通过
 	if config.Env == "test" {
 		return true
@@ -83,6 +163,8 @@ func IgnoreSign(className string) bool {
 // IpPassCheck 检查IP是否允许通过
 // 如果为测试环境 则内网IP 直接通过
 func IpPassCheck(ip string, className string) bool {
+	config := Info()
+
 	//如果为测试环境 或内网IP 则直接通过
 	if config.Env == "test" || cFunc.InnerIP(ip) {
 		return true
@@ -105,6 +187,21 @@ func IpPassCheck(ip string, className string) bool {
 	return true
 }
 
+// ClientCertCheck 是否需要校验客户端证书 开启mTLS且class不在ignoreMtlsCheck中时需要
+func ClientCertCheck(className string) bool {
+	config := Info()
+
+	if config.Http.ClientAuth == "" {
+		return false
+	}
+
+	if _, ok := config.ignoreMtlsClass[className]; ok {
+		return false
+	}
+
+	return true
+}
+
 // IgnoreIp 是否忽略ip检查
 func (c *Config) ignoreIpCheckClass(className string) bool {
 	if _, ok := c.ignoreIpClass[className]; ok {
@@ -116,15 +213,14 @@ func (c *Config) ignoreIpCheckClass(className string) bool {
 
 // New 新建配置信息
 func New(configFileName string) *Config {
-	cc := &Config{
-		ipPass:           make(map[string]bool, 0),
-		ignoresSignClass: make(map[string]bool, 0),
-		ignoreIpClass:    make(map[string]bool, 0),
-	}
+	cc := &Config{}
 
 	var err error
 
-	cc.configPath, err = path.ConfigsDir("")
+	cc.configPath = configDir
+	if cc.configPath == "" {
+		cc.configPath, err = path.ConfigsDir("")
+	}
 
 	_, err = toml.DecodeFile(cc.configPath+configFileName, cc)
 	if err != nil {
@@ -143,12 +239,44 @@ func New(configFileName string) *Config {
 	if err = cc.checkParam(); err != nil {
 		mLog.Fatal(err)
 	}
+	cc.buildClass()
 
 	return cc
 }
 
+// 将逗号分隔的类与ip列表转换为map 方便查询
+func (c *Config) buildClass() {
+	c.ignoresSignClass = splitSet(c.IgnoreSignCheck)
+	c.ipPass = splitSet(c.IpPass)
+	c.ignoreIpClass = splitSet(c.IgnoreIpCheck)
+	c.ignoreMtlsClass = splitSet(c.IgnoreMtlsCheck)
+}
+
+func splitSet(str string) map[string]bool {
+	m := make(map[string]bool)
+	for _, v := range strings.Split(str, ",") {
+		s := strings.TrimSpace(v)
+		if s != "" {
+			m[s] = true
+		}
+	}
+
+	return m
+}
+
 // 检查设置的参数 是否正确
 func (c *Config) checkParam() error {
+	//返回数据的字段名称
+	if c.Response.Msg == "" {
+		c.Response.Msg = "msg"
+	}
+	if c.Response.Ret == "" {
+		c.Response.Ret = "ret"
+	}
+	if c.Response.Data == "" {
+		c.Response.Data = "data"
+	}
+
 	//检查http参数
 	if c.Http.HTTP {
 		if c.Http.PORT == "" {
@@ -169,9 +297,87 @@ func (c *Config) checkParam() error {
 			if _, err := os.Stat(c.Http.HTTPSPEM); err != nil {
 				return errors.New("没找到配置的证书文件" + err.Error())
 			}
+
+			for k, v := range c.Http.Certs {
+				if v.Pem == "" || v.Key == "" {
+					return errors.New("https证书不能为空")
+				}
+
+				c.Http.Certs[k].Pem = c.configPath + v.Pem
+				c.Http.Certs[k].Key = c.configPath + v.Key
+
+				if _, err := os.Stat(c.Http.Certs[k].Pem); err != nil {
+					return errors.New("没找到配置的证书文件" + err.Error())
+				}
+
+				if _, err := os.Stat(c.Http.Certs[k].Key); err != nil {
+					return errors.New("没找到配置的证书文件" + err.Error())
+				}
+			}
+
+			switch c.Http.ClientAuth {
+			case "":
+				c.Http.ClientCa = ""
+			case ClientAuthRequire, ClientAuthOptional:
+				if c.Http.ClientCa == "" {
+					return errors.New("mTLS需要配置clientCa")
+				}
+
+				c.Http.ClientCa = c.configPath + c.Http.ClientCa
+
+				if _, err := os.Stat(c.Http.ClientCa); err != nil {
+					return errors.New("没找到配置的CA文件" + err.Error())
+				}
+			default:
+				return errors.New("不支持的clientAuth:" + c.Http.ClientAuth)
+			}
 		} else {
 			c.Http.HTTPSKEY = ""
 			c.Http.HTTPSPEM = ""
+			c.Http.HttpsPort = ""
+			c.Http.Certs = nil
+			c.Http.ClientCa = ""
+			c.Http.ClientAuth = ""
+		}
+
+		if c.Http.Redirect && c.Http.HttpsPort == "" {
+			return errors.New("http重定向到https需要同时开启https并配置httpsPort")
+		}
+
+		if c.Http.RpcPath != "" && !strings.HasPrefix(c.Http.RpcPath, "/") {
+			c.Http.RpcPath = "/" + c.Http.RpcPath
+		}
+	}
+	if c.Http.MaxBodySize <= 0 {
+		c.Http.MaxBodySize = 32
+	}
+
+	//检查加密配置 公钥为文件路径时读取文件内容
+	for k, v := range c.Encrypt.Keys {
+		tpe := v.Type
+		if tpe == "" {
+			tpe = c.Encrypt.Type
+		}
+
+		switch tpe {
+		case "", cFunc.SignMd5, cFunc.SignSha256, cFunc.SignHmacSha256:
+		case cFunc.SignRsa, cFunc.SignEd25519:
+			if !strings.HasPrefix(strings.TrimSpace(v.Value), "-----BEGIN") {
+				b, err := os.ReadFile(c.configPath + v.Value)
+				if err != nil {
+					return errors.New("没找到配置的公钥文件" + err.Error())
+				}
+				c.Encrypt.Keys[k].Value = string(b)
+			}
+		default:
+			return errors.New("不支持的签名方式:" + tpe)
+		}
+	}
+
+	//检查限流规则
+	for _, v := range c.Limiter {
+		if err := v.Check(); err != nil {
+			return err
 		}
 	}
 
@@ -205,75 +411,61 @@ func (c *Config) checkParam() error {
 	return nil
 }
 
-func resetConfig(con *Config, configFileName string) {
+// 重新加载配置文件 生成新的配置后整体替换 不修改正在使用的配置
+// http pprof serverId等需要重启才能生效的配置项沿用之前的值
+func resetConfig(configFileName string) {
+	reloadMu.Lock() //重新加载与回调串行执行
+	defer reloadMu.Unlock()
+
+	con := config.Load().(*Config)
+
 	var err error
-	cc := &Config{}
+	cc := &Config{
+		configPath: con.configPath,
+	}
 
+	//更新后的配置有误时 记录日志并继续使用之前的配置
 	if _, err := os.Stat(con.configPath + configFileName); err != nil {
-		mLog.Fatal("未能加载配置文件", err)
+		mLog.Error("未能加载配置文件 继续使用之前的配置", err)
+		return
 	}
 
 	_, err = toml.DecodeFile(con.configPath+configFileName, cc)
 	if err != nil {
-		mLog.Fatal("无法解析配置文件:", con.configPath+configFileName, err)
+		mLog.Error("无法解析配置文件 继续使用之前的配置:", con.configPath+configFileName, err)
+		return
 	}
 
 	if err = cc.checkParam(); err != nil {
-		mLog.Fatal(err)
+		mLog.Error("配置文件有误 继续使用之前的配置:", err)
+		return
 	}
 
-	//修改可更改的配置项
-	con.AppName = cc.AppName
-	con.AppVersion = cc.AppVersion
-	con.AppVerMark = cc.AppVerMark
+	//不可更改的配置项
+	cc.Http = con.Http
+	cc.Pprof = con.Pprof
+	cc.ServerId = con.ServerId
+	cc.ServerNode = con.ServerNode
 
-	con.Env = cc.Env
+	//忽略签名检查的类 ip白名单 忽略IP检查的类 不需要客户端证书的类
+	cc.buildClass()
 
-	con.Encrypt = cc.Encrypt
-	con.IgnoreSignCheck = cc.IgnoreSignCheck
+	config.Store(cc)
 
-	con.IpCheck = cc.IpCheck
-	con.IpPass = cc.IpPass
-	con.IgnoreIpCheck = cc.IgnoreIpCheck
-
-	con.StaticFiles = cc.StaticFiles
-
-	//忽略签名检查的类
-	iSc := strings.Split(con.IgnoreSignCheck, ",")
-	for _, v := range iSc {
-		s := strings.TrimSpace(v)
-		if s != "" {
-			con.ignoresSignClass[s] = true
-		}
-	}
+	mLog.SetEvn(cc.Env)
 
-	//ip白名单
-	iBip := strings.Split(con.IpPass, ",")
-	for _, v := range iBip {
-		s := strings.TrimSpace(v)
-		if s != "" {
-			con.ipPass[s] = true
-		}
+	for _, f := range reloadFuncs {
+		f(cc)
 	}
-
-	//忽略IP检查的类
-	iSip := strings.Split(con.IgnoreIpCheck, ",")
-	for _, v := range iSip {
-		s := strings.TrimSpace(v)
-		if s != "" {
-			con.ignoreIpClass[s] = true
-		}
-	}
-
-	mLog.SetEvn(cc.Env)
 }
 
-func init() {
-	configFileName := "app.toml"
-	config = New(configFileName)
+// 加载配置文件
+func load() {
+	cc := New(configFileName)
+	config.Store(cc)
 
 	//包含一次冗余调用
-	fileMonitor.New(config.configPath+configFileName, func(i interface{}) {
-		resetConfig(config, configFileName)
+	fileMonitor.New(cc.configPath+configFileName, func(i interface{}) {
+		resetConfig(configFileName)
 	})
 }
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testDir string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "zoo-config")
+	if err != nil {
+		panic(err)
+	}
+	testDir = dir
+	if err = os.WriteFile(filepath.Join(dir, configFileName), []byte(appToml), 0644); err != nil {
+		panic(err)
+	}
+	SetDir(dir)
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// http未开启时保留clientAuth 用于测试ClientCertCheck
+const appToml = `
+appName = "zoo"
+serverId = 1
+env = "dev"
+ipCheck = true
+ipPass = "1.1.1.1, 2.2.2.2"
+ignoreSignCheck = "public, login"
+ignoreIpCheck = "public"
+ignoreMtlsCheck = "public,health"
+
+[http]
+    PORT = ":8080"
+    clientAuth = "optional"
+`
+
+// 写入配置文件并重新加载
+func reload(t *testing.T, content string) {
+	if err := os.WriteFile(filepath.Join(testDir, configFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resetConfig(configFileName)
+}
+
+func TestClassCheck(t *testing.T) {
+	//首次加载即可使用 不依赖文件监控的回调
+	if !IgnoreSign("login") || IgnoreSign("order") {
+		t.Error("IgnoreSign")
+	}
+	if !IpPassCheck("2.2.2.2", "order") || !IpPassCheck("8.8.8.8", "public") || IpPassCheck("8.8.8.8", "order") {
+		t.Error("IpPassCheck")
+	}
+	if !IpPassCheck("192.168.1.1", "order") {
+		t.Error("inner ip should pass")
+	}
+	if ClientCertCheck("health") || !ClientCertCheck("order") {
+		t.Error("ClientCertCheck")
+	}
+}
+
+func TestReload(t *testing.T) {
+	defer reload(t, appToml)
+
+	var got *Config
+	OnReload(func(c *Config) { got = c })
+
+	old := Info()
+	reload(t, `
+appName = "zoo2"
+serverId = 2
+env = "dev"
+ipCheck = true
+ipPass = "3.3.3.3"
+ignoreSignCheck = "order"
+ignoreMtlsCheck = "order"
+
+[http]
+    PORT = ":9090"
+`)
+
+	cc := Info()
+	if cc == old || got != cc {
+		t.Fatal("reload did not swap in a new config")
+	}
+	if cc.AppName != "zoo2" {
+		t.Errorf("AppName %s", cc.AppName)
+	}
+
+	//从配置中移除的类与ip不再生效
+	if IgnoreSign("login") || !IgnoreSign("order") {
+		t.Error("IgnoreSign after reload")
+	}
+	if IpPassCheck("2.2.2.2", "order") || IpPassCheck("8.8.8.8", "public") || !IpPassCheck("3.3.3.3", "order") {
+		t.Error("IpPassCheck after reload")
+	}
+	if !ClientCertCheck("health") || ClientCertCheck("order") {
+		t.Error("ClientCertCheck after reload")
+	}
+
+	//需要重启的配置沿用之前的值
+	if cc.Http.PORT != ":8080" || cc.Http.ClientAuth != "optional" || cc.ServerId != 1 || cc.ServerNode != old.ServerNode {
+		t.Errorf("restart only fields changed: %+v serverId=%d", cc.Http, cc.ServerId)
+	}
+
+	//之前取得的配置不被修改
+	if old.AppName != "zoo" || !old.ignoresSignClass["login"] || old.ignoresSignClass["order"] || !old.ipPass["2.2.2.2"] {
+		t.Error("old config modified by reload")
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	defer reload(t, appToml)
+
+	reload(t, "appName = ")
+	if Info().AppName != "zoo" || !IgnoreSign("login") {
+		t.Error("invalid toml replaced the config")
+	}
+
+	reload(t, appToml+`
+[[limiter]]
+    key = "unknown"
+    rate = 1
+`)
+	if len(Info().Limiter) != 0 {
+		t.Error("config with invalid limiter applied")
+	}
+}
@@ -2,15 +2,31 @@ package config
 
 // Encrypt http请求加密处理验证方式
 type Encrypt struct {
-	Type string     `toml:"type"`
-	Keys []struct { //加密使用的键值对
-		Key   string `toml:"key"`
-		Value string `toml:"value"`
-	} `toml:"keys"`
+	Type        string       `toml:"type"`        //默认签名方式 md5 sha256 hmac-sha256 rsa ed25519 为空则为md5
+	Keys        []EncryptKey `toml:"keys"`        //加密使用的键值对
+	ReplayCheck bool         `toml:"replayCheck"` //是否开启param签名的防重放检查 开启后签名必须包含timestamp和nonce header签名始终检查
+	TimeSkew    int64        `toml:"timeSkew"`    //允许的时间误差 单位秒 默认300
+	NonceSize   int          `toml:"nonceSize"`   //内存中最多保留的nonce数量 默认100000
 }
 
-//// EncryptKey 加密键值对
-//type EncryptKey struct {
-//	Key   string `toml:"key"`
-//	Value string `toml:"value"`
-//}
+// EncryptKey 加密键值对
+// rsa ed25519时value为公钥pem内容 或configs目录下的公钥文件路径
+type EncryptKey struct {
+	Key   string `toml:"key"`
+	Value string `toml:"value"`
+	Type  string `toml:"type"` //该key使用的签名方式 为空则使用Encrypt.Type
+}
+
+// Key 根据app_key查找对应的秘钥配置 Type已按默认签名方式补全
+func (e Encrypt) Key(appKey string) (EncryptKey, bool) {
+	for _, v := range e.Keys {
+		if v.Key == appKey {
+			if v.Type == "" {
+				v.Type = e.Type
+			}
+			return v, true
+		}
+	}
+
+	return EncryptKey{}, false
+}
@@ -3,6 +3,7 @@ package control
 import (
 	"github.com/solaa51/zoo/system/mCtx"
 	"net/http"
+	"reflect"
 )
 
 // Control http服务 class接口
@@ -10,6 +11,11 @@ type Control interface {
 	SetCtx(w http.ResponseWriter, r *http.Request, className string, methodName string) error //设置请求上下文处理
 }
 
+// ConSetter 可直接设置已构建好的请求上下文 rpc调用使用 继承Controller即实现
+type ConSetter interface {
+	SetCon(ctx *mCtx.Con)
+}
+
 // Controller 基础控制器 http服务上的其他控制器必须继承Controller才能正常使用
 type Controller struct {
 	Ctx *mCtx.Con
@@ -27,3 +33,51 @@ func (c *Controller) SetCtx(w http.ResponseWriter, r *http.Request, className st
 
 	return nil
 }
+
+// SetCon 直接设置已构建好的请求上下文
+func (c *Controller) SetCon(ctx *mCtx.Con) {
+	c.Ctx = ctx
+}
+
+// Con 取出SetCtx为控制器设置的请求上下文 即控制器的Ctx成员 没有时返回nil
+func Con(c Control) *mCtx.Con {
+	f := ctxField(c)
+	if !f.IsValid() {
+		return nil
+	}
+
+	ctx, _ := f.Interface().(*mCtx.Con)
+	return ctx
+}
+
+// SetCon 为控制器设置已构建好的请求上下文
+// 优先调用控制器的SetCon 否则设置控制器的Ctx成员 都不存在时返回false
+func SetCon(c Control, ctx *mCtx.Con) bool {
+	if cs, ok := c.(ConSetter); ok {
+		cs.SetCon(ctx)
+		return true
+	}
+
+	f := ctxField(c)
+	if !f.IsValid() || !f.CanSet() {
+		return false
+	}
+
+	f.Set(reflect.ValueOf(ctx))
+	return true
+}
+
+// 控制器的Ctx成员 包含通过组合继承的
+func ctxField(c Control) reflect.Value {
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+
+	f := v.Elem().FieldByName("Ctx")
+	if !f.IsValid() || !f.CanInterface() || f.Type() != reflect.TypeOf((*mCtx.Con)(nil)) {
+		return reflect.Value{}
+	}
+
+	return f
+}
@@ -0,0 +1,177 @@
+package gHttp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/solaa51/zoo/system/config"
+	"github.com/solaa51/zoo/system/library/fileMonitor"
+	"github.com/solaa51/zoo/system/mLog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+https证书管理
+	通过tls.Config.GetCertificate返回证书 证书文件修改后自动重新加载 不需要重启服务
+	可配置多个证书 按客户端请求的域名(SNI)选择 支持*.a.com通配符证书 未匹配时使用httpsPem httpsKey
+
+	[[http.certs]]
+		pem = "ssl/b.com.pem"
+		key = "ssl/b.com.key"
+*/
+
+// 一对证书文件
+type certPair struct {
+	pem  string
+	key  string
+	cert *tls.Certificate
+}
+
+// 按域名索引的证书 整体替换
+type certSet struct {
+	def   *tls.Certificate
+	names map[string]*tls.Certificate
+}
+
+type certManager struct {
+	mu    sync.Mutex //重新加载时修改pairs
+	pairs []*certPair
+	set   atomic.Value //*certSet
+
+	clientCAs  *x509.CertPool     //mTLS 校验客户端证书的CA
+	clientAuth tls.ClientAuthType //mTLS 客户端证书校验方式
+}
+
+// 加载证书并监控文件变化 pem key为默认证书
+func newCertManager(pem string, key string, others []config.Cert) (*certManager, error) {
+	m := &certManager{}
+	for _, v := range append([]config.Cert{{Pem: pem, Key: key}}, others...) {
+		cert, err := loadCert(v.Pem, v.Key)
+		if err != nil {
+			return nil, errors.New("加载证书失败" + v.Pem + ":" + err.Error())
+		}
+		m.pairs = append(m.pairs, &certPair{pem: v.Pem, key: v.Key, cert: cert})
+	}
+	m.build()
+
+	//证书与私钥任意一个修改后重新加载 修改了一半时加载失败 继续使用原证书
+	for _, v := range m.pairs {
+		p := v
+		fileMonitor.New(p.pem, func(interface{}) { m.reload(p) })
+		fileMonitor.New(p.key, func(interface{}) { m.reload(p) })
+	}
+
+	return m, nil
+}
+
+func loadCert(pem string, key string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(pem, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+// 重新加载一对证书 内容未变化时不处理
+func (m *certManager) reload(p *certPair) {
+	cert, err := loadCert(p.pem, p.key)
+	if err != nil {
+		mLog.Error("重新加载证书失败，继续使用原证书：" + p.pem + " " + err.Error())
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if bytes.Equal(cert.Certificate[0], p.cert.Certificate[0]) {
+		return
+	}
+	p.cert = cert
+	m.build()
+
+	mLog.Info("证书已更新："+p.pem, " 域名：", strings.Join(cert.Leaf.DNSNames, ","), " 过期时间：", cert.Leaf.NotAfter.Format("2006-01-02 15:04:05"))
+}
+
+// 按证书中的域名建立索引 靠前的证书优先
+func (m *certManager) build() {
+	set := &certSet{
+		def:   m.pairs[0].cert,
+		names: make(map[string]*tls.Certificate),
+	}
+
+	for _, p := range m.pairs {
+		names := p.cert.Leaf.DNSNames
+		if len(names) == 0 && p.cert.Leaf.Subject.CommonName != "" {
+			names = []string{p.cert.Leaf.Subject.CommonName}
+		}
+		for _, n := range names {
+			n = strings.ToLower(n)
+			if _, ok := set.names[n]; !ok {
+				set.names[n] = p.cert
+			}
+		}
+	}
+
+	m.set.Store(set)
+}
+
+// 按SNI选择证书 先完全匹配 再匹配通配符 最后使用默认证书
+func (m *certManager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := m.set.Load().(*certSet)
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := set.names[name]; ok {
+			return cert, nil
+		}
+
+		if i := strings.Index(name, "."); i > 0 {
+			if cert, ok := set.names["*"+name[i:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+
+	return set.def, nil
+}
+
+// 开启mTLS 加载校验客户端证书的CA
+// require时握手必须提供证书 optional时提供了才校验 由handler按class检查
+func (m *certManager) setClientAuth(caFile string, mode string) error {
+	b, err := os.ReadFile(caFile)
+	if err != nil {
+		return errors.New("读取CA文件失败：" + err.Error())
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return errors.New("CA文件中没有可用的证书：" + caFile)
+	}
+
+	m.clientCAs = pool
+	m.clientAuth = tls.VerifyClientCertIfGiven
+	if mode == config.ClientAuthRequire {
+		m.clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return nil
+}
+
+// https服务使用的tls配置
+func (m *certManager) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.getCertificate,
+		ClientCAs:      m.clientCAs,
+		ClientAuth:     m.clientAuth,
+	}
+}
@@ -0,0 +1,172 @@
+package gHttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/solaa51/zoo/system/config"
+)
+
+// 生成自签名证书 写入dir/name.pem dir/name.key
+func writeCert(t *testing.T, dir string, name string, cn string, dnsNames ...string) config.Cert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := config.Cert{Pem: filepath.Join(dir, name+".pem"), Key: filepath.Join(dir, name+".key")}
+	if err = os.WriteFile(c.Pem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(c.Key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// 按SNI选择的证书的第一个域名 没有域名时为CommonName
+func certName(t *testing.T, m *certManager, serverName string) string {
+	cert, err := m.getCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Leaf.DNSNames) > 0 {
+		return cert.Leaf.DNSNames[0]
+	}
+
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestCertSNI(t *testing.T) {
+	dir := t.TempDir()
+	def := writeCert(t, dir, "a", "a.com", "a.com")
+	m, err := newCertManager(def.Pem, def.Key, []config.Cert{
+		writeCert(t, dir, "b", "b.com", "b.com", "www.b.com"),
+		writeCert(t, dir, "c", "*.c.com", "*.c.com"),
+		writeCert(t, dir, "d", "d.com"),                 //没有SAN时使用CommonName
+		writeCert(t, dir, "b2", "b.com", "other.b.com"), //与前面的证书重复时靠前的优先
+		writeCert(t, dir, "b3", "b.com", "dup.b.com", "b.com"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"a.com":       "a.com",
+		"b.com":       "b.com",
+		"www.b.com":   "b.com",
+		"WWW.B.COM.":  "b.com",
+		"x.c.com":     "*.c.com",
+		"c.com":       "a.com", //通配符不匹配上级域名
+		"y.x.c.com":   "a.com", //通配符只匹配一级
+		"d.com":       "d.com",
+		"other.b.com": "other.b.com",
+		"unknown.com": "a.com",
+		"":            "a.com", //没有SNI时使用默认证书
+	}
+	for serverName, want := range cases {
+		if got := certName(t, m, serverName); got != want {
+			t.Errorf("%q got %s, want %s", serverName, got, want)
+		}
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+	def := writeCert(t, dir, "a", "a.com", "a.com")
+	b := writeCert(t, dir, "b", "b.com", "b.com")
+	m, err := newCertManager(def.Pem, def.Key, []config.Cert{b})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//只更新了证书 与私钥不匹配 继续使用原证书
+	next := writeCert(t, t.TempDir(), "b", "b.com", "e.com")
+	pemBytes, _ := os.ReadFile(next.Pem)
+	if err = os.WriteFile(b.Pem, pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	m.reload(m.pairs[1])
+	if got := certName(t, m, "b.com"); got != "b.com" {
+		t.Errorf("half updated pair: got %s, want old b.com", got)
+	}
+
+	//私钥也更新后切换 按新证书的域名选择
+	keyBytes, _ := os.ReadFile(next.Key)
+	if err = os.WriteFile(b.Key, keyBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	m.reload(m.pairs[1])
+	if got := certName(t, m, "e.com"); got != "e.com" {
+		t.Errorf("after reload: got %s, want e.com", got)
+	}
+	if got := certName(t, m, "b.com"); got != "a.com" {
+		t.Errorf("removed name: got %s, want default a.com", got)
+	}
+}
+
+// tls握手按SNI返回证书
+func TestCertHandshake(t *testing.T) {
+	dir := t.TempDir()
+	def := writeCert(t, dir, "a", "a.com", "a.com")
+	m, err := newCertManager(def.Pem, def.Key, []config.Cert{writeCert(t, dir, "c", "*.c.com", "*.c.com")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", m.tlsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = c.(*tls.Conn).Handshake()
+			_ = c.Close()
+		}
+	}()
+
+	for serverName, want := range map[string]string{"x.c.com": "*.c.com", "a.com": "a.com"} {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := conn.ConnectionState().PeerCertificates[0].DNSNames[0]
+		_ = conn.Close()
+		if got != want {
+			t.Errorf("%s got %s, want %s", serverName, got, want)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package gHttp
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"github.com/solaa51/zoo/system/config"
 	"github.com/solaa51/zoo/system/handler"
+	"github.com/solaa51/zoo/system/mCtx"
 	"github.com/solaa51/zoo/system/mLog"
 	"net"
 	"net/http"
@@ -14,6 +16,10 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -22,49 +28,180 @@ import (
 用于启动http服务和支持热重启
 */
 type gracefulHttp struct {
+	servers []*httpServer //主服务 AddServer添加的服务以及pprof 热重启时按名称传递socket
+}
+
+// 单个监听端口的http服务
+type httpServer struct {
+	name     string
 	server   *http.Server //http服务server配置
 	listener net.Listener
+	active   int64 //正在处理的请求数
+	optional bool  //启动失败时只记录日志 不影响其他服务 如pprof
+
+	httpsPem  string      //https ssl配置
+	httpsKey  string      //https ssl配置
+	tlsConfig *tls.Config //https 由certManager提供证书 优先于httpsPem httpsKey
 
-	httpsPem string //https ssl配置
-	httpsKey string //https ssl配置
+	started chan struct{} //开始接收连接时关闭
+	failed  chan error    //开始接收连接之前Serve返回的错误
 }
 
-// 启动服务
-func (g *gracefulHttp) start(config *config.Config) {
-	//pprof 启动
-	if config.Pprof.HTTP {
-		mLog.Info("pprof启动：", config.Pprof.PORT+"/debug/pprof 访问")
-		if config.Pprof.HTTPS {
-			go func() {
-				err := http.ListenAndServeTLS(config.Pprof.PORT, config.Pprof.HTTPSPEM, config.Pprof.HTTPSKEY, nil)
-				if err != nil {
-					mLog.Error("pprof启动报错：", config.Pprof.PORT)
-				}
-			}()
-		} else {
-			go func() {
-				err := http.ListenAndServe(config.Pprof.PORT, nil)
-				if err != nil {
-					mLog.Error("pprof启动报错：", config.Pprof.PORT)
-					return
-				}
-			}()
-		}
-	}
+// 通过AddServer添加的服务
+type extraServer struct {
+	name    string
+	port    string
+	handler http.Handler
+}
+
+var extraServers = make([]*extraServer, 0)
+
+// 服务关闭时执行的函数
+var shutdownFuncs = make([]func(ctx context.Context), 0)
+
+// OnShutdown 添加服务关闭时执行的函数 与http服务的平滑关闭同时执行
+// 被接管的连接(如websocket)不受http.Server.Shutdown管理 可在此关闭
+//
+//	gHttp.OnShutdown(func(ctx context.Context) { _ = hub.Shutdown(ctx) })
+func OnShutdown(f func(ctx context.Context)) {
+	shutdownFuncs = append(shutdownFuncs, f)
+}
 
+// AddServer 添加一个与主服务同时运行的http服务 需在Start或StartCustom之前调用
+// 例如对外的api与内部的管理后台使用不同的端口以及不同的路由、handler
+//
+//	admin := handler.New()
+//	admin.SetRouter(adminRouter)
+//	gHttp.AddServer("admin", ":8081", admin)
+func AddServer(name string, port string, handler http.Handler) {
+	extraServers = append(extraServers, &extraServer{
+		name:    name,
+		port:    port,
+		handler: handler,
+	})
+}
+
+// 启动服务 等待全部服务开始接收连接后返回
+// 服务启动失败(如证书文件错误)时关闭全部服务并返回错误 可选服务(如pprof)只记录日志
+func (g *gracefulHttp) start() error {
 	//http 服务放于goroutine中
-	go func() {
-		var err error
-		if g.httpsPem != "" && g.httpsKey != "" {
-			err = g.server.ServeTLS(g.listener, g.httpsPem, g.httpsKey)
-		} else {
-			err = g.server.Serve(g.listener)
-		}
+	for _, v := range g.servers {
+		v.started = make(chan struct{})
+		v.failed = make(chan error, 1)
+		go v.serve()
+	}
 
-		if err != nil {
-			mLog.Fatal("http服务启动失败：" + err.Error())
+	for _, v := range g.servers {
+		select {
+		case <-v.started:
+		case err := <-v.failed:
+			if v.optional {
+				mLog.Error(v.name + "服务启动失败：" + err.Error())
+				continue
+			}
+			g.close()
+			return errors.New(v.name + "服务启动失败：" + err.Error())
 		}
-	}()
+	}
+
+	return nil
+}
+
+// 关闭全部服务与监听
+func (g *gracefulHttp) close() {
+	for _, v := range g.servers {
+		_ = v.server.Close()
+		_ = v.listener.Close()
+	}
+}
+
+func (s *httpServer) serve() {
+	ln := &startedListener{Listener: s.listener, started: s.started}
+
+	var err error
+	if s.tlsConfig != nil {
+		s.server.TLSConfig = s.tlsConfig
+		err = s.server.ServeTLS(ln, "", "")
+	} else if s.httpsPem != "" && s.httpsKey != "" {
+		err = s.server.ServeTLS(ln, s.httpsPem, s.httpsKey)
+	} else {
+		err = s.server.Serve(ln)
+	}
+
+	if err == nil || err == http.ErrServerClosed {
+		return
+	}
+
+	select {
+	case <-s.started: //运行中出错
+	default: //未开始接收连接 由start处理
+		s.failed <- err
+		return
+	}
+
+	if s.optional {
+		mLog.Error(s.name + "服务运行出错：" + err.Error())
+		return
+	}
+	mLog.Fatal(s.name + "服务运行出错：" + err.Error())
+}
+
+// 首次Accept时关闭started 表示Serve已完成证书加载等准备 开始接收连接
+type startedListener struct {
+	net.Listener
+	once    sync.Once
+	started chan struct{}
+}
+
+func (l *startedListener) Accept() (net.Conn, error) {
+	l.once.Do(func() {
+		close(l.started)
+	})
+
+	return l.Listener.Accept()
+}
+
+// 使用certManager提供的证书 开启了mTLS时标记该服务 只校验该服务上请求的客户端证书
+func (s *httpServer) useTLS(certs *certManager, clientAuth string) {
+	s.tlsConfig = certs.tlsConfig()
+	if clientAuth != "" {
+		s.server.ConnContext = mCtx.WithMtls
+	}
+}
+
+// 记录正在处理的请求数
+func (s *httpServer) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.active, 1)
+		defer atomic.AddInt64(&s.active, -1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// 平滑关闭全部服务
+func (g *gracefulHttp) shutdown(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, v := range g.servers {
+		wg.Add(1)
+		go func(s *httpServer) {
+			defer wg.Done()
+			if n := atomic.LoadInt64(&s.active); n > 0 {
+				mLog.Info(s.name+"服务等待请求处理完成，剩余：", n)
+			}
+			if err := s.server.Shutdown(ctx); err != nil {
+				mLog.Error(s.name+"服务平滑关闭超时，未完成的请求：", atomic.LoadInt64(&s.active))
+				_ = s.server.Close()
+			}
+		}(v)
+	}
+	for _, f := range shutdownFuncs {
+		wg.Add(1)
+		go func(f func(ctx context.Context)) {
+			defer wg.Done()
+			f(ctx)
+		}(f)
+	}
+	wg.Wait()
 }
 
 // 监听信号 用于热更新
@@ -75,22 +212,26 @@ func (g *gracefulHttp) singleListen() {
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	for {
 		sig := <-ch
-		ctx, _ := context.WithTimeout(context.Background(), time.Second*20)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
 		switch sig {
 		case syscall.SIGINT, syscall.SIGTERM:
 			mLog.Info("收到kill信号，关闭服务")
 			signal.Stop(ch)
-			_ = g.server.Shutdown(ctx) //平滑关闭已有连接
+			g.shutdown(ctx) //平滑关闭已有连接
+			cancel()
 			return
 		case syscall.SIGHUP:
 			mLog.Info("收到sigHup信号:重启服务")
 			err := g.restart()
-			if err != nil {
-				mLog.Error("热重启服务失败:", err)
+			if err != nil { //新进程未就绪 继续提供服务
+				mLog.Error("热重启服务失败，当前进程继续提供服务:", err)
+				cancel()
+				continue
 			}
 
-			_ = g.server.Shutdown(ctx) //平滑关闭已有连接
-			mLog.Info("热重启完成")
+			g.shutdown(ctx) //平滑关闭已有连接
+			cancel()
+			mLog.Info("热重启完成，旧进程退出 pid:", os.Getpid())
 			return
 		}
 	}
@@ -123,8 +264,9 @@ func (gracefulHttp) updateSelf() {
 						continue
 					}
 
-					//发送信号
+					//发送信号 重启失败时等待文件再次更新
 					mLog.Info("检测到app文件更新:发送升级信号sigHup")
+					aLT = an.ModTime().Unix()
 					_ = p.Signal(syscall.SIGHUP)
 				}
 			}
@@ -132,32 +274,87 @@ func (gracefulHttp) updateSelf() {
 	}()
 }
 
-// 重启服务
+// 重启服务 新进程就绪后返回nil 未就绪时结束新进程并返回错误
 func (g *gracefulHttp) restart() error {
 	mLog.Info("重启服务中...")
-	ln, ok := g.listener.(*net.TCPListener)
-	if !ok {
-		return errors.New("转换tcp listener失败")
+	files := make([]*os.File, 0, len(g.servers)+1)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	fds := make([]string, 0, len(g.servers))
+	for _, v := range g.servers {
+		ln, ok := v.listener.(*net.TCPListener)
+		if !ok {
+			return errors.New(v.name + "转换tcp listener失败")
+		}
+
+		ff, err := ln.File()
+		if err != nil {
+			return errors.New(v.name + "获取socket文件描述符失败")
+		}
+		files = append(files, ff)
+		fds = append(fds, v.name+":"+strconv.Itoa(3+len(files)-1))
 	}
 
-	ff, err := ln.File()
+	//就绪管道 写端传递给新进程
+	r, w, err := os.Pipe()
 	if err != nil {
-		return errors.New("获取socket文件描述符失败")
+		return errors.New("创建就绪管道失败：" + err.Error())
 	}
+	defer r.Close()
+	files = append(files, w)
 
 	cmd := exec.Command(os.Args[0], []string{"-g"}...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.ExtraFiles = []*os.File{ff} //重用原有的socket文件描述符
+	cmd.ExtraFiles = files //重用原有的socket文件描述符 从3开始 最后为就绪管道
+	cmd.Env = append(os.Environ(),
+		listenFdsEnv+"="+strings.Join(fds, ","),
+		readyFdEnv+"="+strconv.Itoa(3+len(files)-1),
+	)
 
 	err = cmd.Start()
+	g.setNonblock() //传递描述符时socket被设为阻塞模式 当前进程需继续accept
 	if err != nil {
 		return errors.New("启动新进程报错了：" + err.Error())
 	}
+	_ = w.Close() //新进程退出时读端可以收到EOF
+
+	//回收新进程 避免当前进程继续运行时产生僵尸进程
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	mLog.Info("新进程已启动，等待就绪 pid:", cmd.Process.Pid)
+	if err = waitReady(cmd, r, exited); err != nil {
+		return err
+	}
+	mLog.Info("新进程已就绪 pid:", cmd.Process.Pid)
 
 	return nil
 }
 
+// 恢复socket的非阻塞模式
+// 与新进程共享的socket被exec设为阻塞模式后 当前进程的accept不能被关闭 平滑关闭时会一直等待
+func (g *gracefulHttp) setNonblock() {
+	for _, v := range g.servers {
+		sc, ok := v.listener.(syscall.Conn)
+		if !ok {
+			continue
+		}
+		raw, err := sc.SyscallConn()
+		if err != nil {
+			continue
+		}
+		_ = raw.Control(func(fd uintptr) {
+			_ = syscall.SetNonblock(int(fd), true)
+		})
+	}
+}
+
 // Start 开启一个http默认服务
 func Start() error {
 	cc := config.Info()
@@ -168,9 +365,19 @@ func Start() error {
 	return run(cc, handler.Handle)
 }
 
-// StartCustom 自定义配置和handler 启动http服务 以后再来补充
+// StartCustom 自定义配置和handler 启动http服务 同时启动AddServer添加的服务
+// 不解析命令行参数 热重启启动的新进程通过继承的socket识别
 func StartCustom(config *config.Config, handler http.Handler) error {
-	return newGracefulHttp(config, handler, false)
+	return newGracefulHttp(config, handler, gracefulReload())
+}
+
+// 是否为热重启启动的新进程 包含-g参数或存在继承的socket
+func gracefulReload() bool {
+	if f := flag.Lookup("g"); f != nil && f.Value.String() == "true" {
+		return true
+	}
+
+	return os.Getenv(listenFdsEnv) != ""
 }
 
 func run(config *config.Config, handler http.Handler) error {
@@ -205,48 +412,101 @@ func daemon(d bool) {
 
 //检查所需配置 构建gracefulHttp
 func newGracefulHttp(config *config.Config, handler http.Handler, gracefulReload bool) error {
-	var err error
+	gf := &gracefulHttp{}
+
+	servers := []*extraServer{{name: "http", port: config.Http.PORT, handler: handler}}
+	if config.Http.HttpsPort != "" { //http与https同时开启
+		if config.Http.Redirect {
+			servers[0].handler = redirectHandler(config.Http.HttpsPort)
+		}
+		servers = append(servers, &extraServer{name: "https", port: config.Http.HttpsPort, handler: handler})
+	}
 
-	var ln net.Listener
-	if gracefulReload { //启动命令中包含参数 热重启时，从socket文件描述符 重新启动一个监听
-		//当存在监听socket时 socket的文件描述符就是3 所以从本进程的3号文件描述符 恢复socket监听
-		f := os.NewFile(3, "")
-		ln, err = net.FileListener(f)
+	list := append(servers, extraServers...)
+	if config.Pprof.HTTP { //pprof 使用DefaultServeMux
+		list = append(list, &extraServer{name: "pprof", port: config.Pprof.PORT, handler: http.DefaultServeMux})
+	}
+
+	//https证书 文件修改后自动重新加载
+	var certs *certManager
+	if config.Http.HTTPS {
+		var err error
+		certs, err = newCertManager(config.Http.HTTPSPEM, config.Http.HTTPSKEY, config.Http.Certs)
 		if err != nil {
 			return err
 		}
 
-		mLog.Info("升级重启-", os.Args, ln.Addr().String())
-	} else {
-		ln, err = net.Listen("tcp", config.Http.PORT)
+		if config.Http.ClientAuth != "" { //mTLS
+			if err = certs.setClientAuth(config.Http.ClientCa, config.Http.ClientAuth); err != nil {
+				return err
+			}
+		}
+	}
+
+	inherited := make(map[string]int)
+	if gracefulReload {
+		inherited = inheritedFds()
+	}
+
+	for _, v := range list {
+		for _, s := range gf.servers {
+			if s.name == v.name {
+				return errors.New("服务名称重复：" + v.name)
+			}
+		}
+
+		ln, err := listen(v.name, v.port, inherited)
 		if err != nil {
+			if v.name == "pprof" { //pprof启动失败不影响其他服务
+				mLog.Error("pprof启动报错：" + v.port + " " + err.Error())
+				continue
+			}
 			return err
 		}
-	}
 
-	//路由管理器
-	mux := http.NewServeMux()
-	mux.Handle("/", handler)
+		s := &httpServer{
+			name:     v.name,
+			listener: ln,
+		}
+		h := v.handler
+		if v.name == "http" || v.name == "https" {
+			h = hsts(h, config.Http.Hsts, config.Http.HstsSubDomains)
+		}
+		s.server = newServer(v.port, s.track(h))
+		switch v.name {
+		case "http": //https配置仅作用于主服务 单独配置了https端口时http端口不使用证书
+			if config.Http.HttpsPort == "" && certs != nil {
+				s.useTLS(certs, config.Http.ClientAuth)
+			}
+		case "https":
+			s.useTLS(certs, config.Http.ClientAuth)
+		case "pprof":
+			s.httpsPem = config.Pprof.HTTPSPEM
+			s.httpsKey = config.Pprof.HTTPSKEY
+			s.server.WriteTimeout = 0 //profile?seconds=30等采样时间较长
+			s.optional = true
+			mLog.Info("pprof启动：", config.Pprof.PORT+"/debug/pprof 访问")
+		}
+		gf.servers = append(gf.servers, s)
+	}
 
-	server := &http.Server{
-		Addr:         config.Http.PORT,
-		Handler:      mux,
-		TLSConfig:    nil,
-		ReadTimeout:  time.Second * 30,
-		WriteTimeout: time.Second * 30,
+	//新版本中已移除的服务 关闭继承的socket
+	for name, fd := range inherited {
+		mLog.Info("升级重启-关闭未使用的socket：", name)
+		_ = os.NewFile(uintptr(fd), name).Close()
 	}
 
-	gf := &gracefulHttp{
-		server:   server,
-		listener: ln,
-		httpsPem: config.Http.HTTPSPEM,
-		httpsKey: config.Http.HTTPSKEY,
+	//goroutine 启动http服务 全部服务开始接收连接后才通知父进程就绪
+	if err := gf.start(); err != nil {
+		return err
 	}
 
-	//goroutine 启动http服务
-	gf.start(config)
+	for _, v := range gf.servers {
+		mLog.Info("服务启动完成-进程pid:", os.Getpid(), " "+v.name+"端口为:"+v.port())
+	}
 
-	mLog.Info("服务启动完成-进程pid:", os.Getpid(), " http端口为:"+config.Http.PORT)
+	//热重启时通知父进程 已开始提供服务
+	notifyReady()
 
 	//监控该APP可执行文件是否更新
 	gf.updateSelf()
@@ -256,3 +516,74 @@ func newGracefulHttp(config *config.Config, handler http.Handler, gracefulReload
 
 	return nil
 }
+
+// 热重启时继承的socket 环境变量格式为 http:3,admin:4,pprof:5
+const listenFdsEnv = "ZOO_LISTEN_FDS"
+
+// 解析继承的socket 服务名称=>文件描述符
+func inheritedFds() map[string]int {
+	fds := make(map[string]int)
+	for _, v := range strings.Split(os.Getenv(listenFdsEnv), ",") {
+		i := strings.LastIndex(v, ":")
+		if i <= 0 {
+			continue
+		}
+		fd, err := strconv.Atoi(v[i+1:])
+		if err != nil || fd < 3 {
+			continue
+		}
+		fds[v[:i]] = fd
+	}
+	_ = os.Unsetenv(listenFdsEnv)
+
+	return fds
+}
+
+// 创建监听 热重启时按服务名称从继承的socket文件描述符恢复
+// 没有继承的socket时(如新增的服务)重新监听 使用过的描述符从inherited中移除
+func listen(name string, port string, inherited map[string]int) (net.Listener, error) {
+	fd, ok := inherited[name]
+	if !ok {
+		return net.Listen("tcp", port)
+	}
+	delete(inherited, name)
+
+	f := os.NewFile(uintptr(fd), name)
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.New(name + "恢复socket失败：" + err.Error())
+	}
+	_ = f.Close()
+
+	//新版本修改了端口 不再使用继承的socket
+	_, oldPort, _ := net.SplitHostPort(ln.Addr().String())
+	if _, newPort, _ := net.SplitHostPort(port); newPort != "" && newPort != "0" && newPort != oldPort {
+		_ = ln.Close()
+		mLog.Info("升级重启-", name, "端口已修改 重新监听：", port)
+		return net.Listen("tcp", port)
+	}
+
+	mLog.Info("升级重启-", os.Args, name, " ", ln.Addr().String())
+
+	return ln, nil
+}
+
+func newServer(port string, handler http.Handler) *http.Server {
+	//路由管理器
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+
+	return &http.Server{
+		Addr:         port,
+		Handler:      mux,
+		TLSConfig:    nil,
+		ReadTimeout:  time.Second * 30,
+		WriteTimeout: time.Second * 30,
+		ConnContext:  mCtx.WithConn, //sse等长连接需要通过连接取消写超时
+	}
+}
+
+// 实际监听的地址
+func (s *httpServer) port() string {
+	return s.listener.Addr().String()
+}
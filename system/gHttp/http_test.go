@@ -0,0 +1,221 @@
+package gHttp
+
+import (
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestGracefulReload(t *testing.T) {
+	if gracefulReload() {
+		t.Fatal("plain start detected as reload")
+	}
+
+	//热重启的新进程存在继承的socket
+	t.Setenv(listenFdsEnv, "http:3")
+	if !gracefulReload() {
+		t.Error("inherited sockets not detected")
+	}
+	_ = os.Unsetenv(listenFdsEnv)
+
+	//Start解析的-g参数
+	fs := flag.CommandLine
+	defer func() { flag.CommandLine = fs }()
+	flag.CommandLine = flag.NewFlagSet("app", flag.ContinueOnError)
+	g := flag.Bool("g", false, "")
+	if err := flag.CommandLine.Parse([]string{"-g"}); err != nil {
+		t.Fatal(err)
+	}
+	if !*g || !gracefulReload() {
+		t.Error("-g flag not detected")
+	}
+}
+
+func testServer(t *testing.T, name string) *httpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &httpServer{name: name, listener: ln}
+	s.server = newServer(ln.Addr().String(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name)
+	}))
+
+	return s
+}
+
+func TestStart(t *testing.T) {
+	a, b := testServer(t, "http"), testServer(t, "admin")
+	gf := &gracefulHttp{servers: []*httpServer{a, b}}
+	if err := gf.start(); err != nil {
+		t.Fatal(err)
+	}
+	defer gf.close()
+
+	for _, s := range gf.servers {
+		resp, err := http.Get("http://" + s.port())
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if string(body) != s.name {
+			t.Errorf("%s got %q", s.name, body)
+		}
+	}
+}
+
+// Serve在开始接收连接前出错 start返回错误 不通知就绪
+func TestStartFailed(t *testing.T) {
+	ok, bad := testServer(t, "http"), testServer(t, "https")
+	bad.httpsPem = "testdata/missing.pem"
+	bad.httpsKey = "testdata/missing.key"
+	gf := &gracefulHttp{servers: []*httpServer{ok, bad}}
+
+	err := gf.start()
+	if err == nil || !strings.Contains(err.Error(), "https") {
+		t.Fatalf("got %v, want https start error", err)
+	}
+
+	//启动失败后关闭全部服务
+	if _, err = http.Get("http://" + ok.port()); err == nil {
+		t.Error("servers still running after start failed")
+	}
+}
+
+// 可选服务启动失败不影响其他服务
+func TestStartOptional(t *testing.T) {
+	ok, pprof := testServer(t, "http"), testServer(t, "pprof")
+	pprof.httpsPem = "testdata/missing.pem"
+	pprof.httpsKey = "testdata/missing.key"
+	pprof.optional = true
+	gf := &gracefulHttp{servers: []*httpServer{ok, pprof}}
+	if err := gf.start(); err != nil {
+		t.Fatal(err)
+	}
+	defer gf.close()
+
+	resp, err := http.Get("http://" + ok.port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestInheritedFds(t *testing.T) {
+	t.Setenv(listenFdsEnv, "http:3,admin:4,bad,stdout:1,pprof:x,my:svc:5")
+	fds := inheritedFds()
+	want := map[string]int{"http": 3, "admin": 4, "my:svc": 5}
+	if len(fds) != len(want) {
+		t.Fatalf("got %v, want %v", fds, want)
+	}
+	for name, fd := range want {
+		if fds[name] != fd {
+			t.Errorf("%s got %d, want %d", name, fds[name], fd)
+		}
+	}
+	if os.Getenv(listenFdsEnv) != "" {
+		t.Error(listenFdsEnv + " not unset")
+	}
+}
+
+// 模拟父进程传递的socket 返回描述符 原监听已关闭
+func inheritFd(t *testing.T) (int, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = f.Close()
+	_ = ln.Close()
+
+	return fd, addr
+}
+
+func TestListenInherited(t *testing.T) {
+	fd, addr := inheritFd(t)
+	inherited := map[string]int{"http": fd}
+
+	ln, err := listen("http", addr, inherited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() != addr {
+		t.Errorf("got %s, want inherited %s", ln.Addr(), addr)
+	}
+	if _, ok := inherited["http"]; ok {
+		t.Error("used fd not removed from inherited")
+	}
+
+	//继承的socket可以正常接收连接
+	go func() {
+		if c, err := net.Dial("tcp", addr); err == nil {
+			_ = c.Close()
+		}
+	}()
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+}
+
+func TestListenPortChanged(t *testing.T) {
+	fd, addr := inheritFd(t)
+	inherited := map[string]int{"http": fd}
+
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := free.Addr().String()
+	_ = free.Close()
+
+	ln, err := listen("http", port, inherited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() != port {
+		t.Errorf("got %s, want new port %s", ln.Addr(), port)
+	}
+
+	//继承的socket已关闭
+	if c, err := net.Dial("tcp", addr); err == nil {
+		_ = c.Close()
+		t.Error("inherited socket still open after port change")
+	}
+}
+
+func TestListenNew(t *testing.T) {
+	fd, addr := inheritFd(t)
+	defer syscall.Close(fd)
+	inherited := map[string]int{"http": fd}
+
+	//新增的服务重新监听 不使用其他服务的socket
+	ln, err := listen("admin", "127.0.0.1:0", inherited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() == addr {
+		t.Error("new server reused another server's socket")
+	}
+	if inherited["http"] != fd {
+		t.Error("unused fd removed from inherited")
+	}
+}
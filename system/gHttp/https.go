@@ -0,0 +1,59 @@
+package gHttp
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+)
+
+/**
+http与https同时提供服务
+	http = true
+	https = true
+	port = ":80"
+	httpsPort = ":443"
+	redirect = true  #http请求重定向到https
+	hsts = 31536000  #https返回Strict-Transport-Security
+*/
+
+// 将http请求重定向到https httpsPort为https监听端口
+func redirectHandler(httpsPort string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsPort)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		//GET HEAD以外的请求使用308 保留请求方式与body
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
+
+// https请求返回Strict-Transport-Security maxAge小于等于0时不处理
+func hsts(h http.Handler, maxAge int64, subDomains bool) http.Handler {
+	if maxAge <= 0 {
+		return h
+	}
+
+	value := "max-age=" + strconv.FormatInt(maxAge, 10)
+	if subDomains {
+		value += "; includeSubDomains"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package gHttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	cases := []struct {
+		httpsPort string
+		method    string
+		target    string
+		code      int
+		location  string
+	}{
+		{":443", http.MethodGet, "http://a.com/user/info?id=1", http.StatusMovedPermanently, "https://a.com/user/info?id=1"},
+		{":443", http.MethodHead, "http://a.com:80/", http.StatusMovedPermanently, "https://a.com/"},
+		{":443", http.MethodPost, "http://a.com/order/create", http.StatusPermanentRedirect, "https://a.com/order/create"},
+		{":8443", http.MethodGet, "http://a.com:8080/x", http.StatusMovedPermanently, "https://a.com:8443/x"},
+		{"0.0.0.0:8443", http.MethodPut, "http://[::1]:8080/x", http.StatusPermanentRedirect, "https://[::1]:8443/x"},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		redirectHandler(c.httpsPort).ServeHTTP(w, httptest.NewRequest(c.method, c.target, nil))
+		if w.Code != c.code {
+			t.Errorf("%s %s got %d, want %d", c.method, c.target, w.Code, c.code)
+		}
+		if got := w.Header().Get("Location"); got != c.location {
+			t.Errorf("%s %s got Location %q, want %q", c.method, c.target, got, c.location)
+		}
+	}
+}
+
+func TestHsts(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		maxAge     int64
+		subDomains bool
+		target     string
+		want       string
+	}{
+		{31536000, false, "https://a.com/", "max-age=31536000"},
+		{31536000, true, "https://a.com/", "max-age=31536000; includeSubDomains"},
+		{31536000, true, "http://a.com/", ""}, //http请求不返回
+		{0, true, "https://a.com/", ""},       //未开启
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		hsts(ok, c.maxAge, c.subDomains).ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.target, nil))
+		if got := w.Header().Get("Strict-Transport-Security"); got != c.want {
+			t.Errorf("maxAge=%d subDomains=%v %s got %q, want %q", c.maxAge, c.subDomains, c.target, got, c.want)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("handler not called: %d", w.Code)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package gHttp
+
+import (
+	"errors"
+	"github.com/solaa51/zoo/system/mLog"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+/**
+热重启就绪握手
+	父进程创建管道 将写端作为额外的文件描述符传递给子进程 描述符编号通过环境变量ZOO_READY_FD告知
+	子进程全部服务开始接收连接(Serve已调用Accept)后写入ready并关闭 任一服务启动失败则不写入 父进程收到后才停止接收新连接
+	子进程退出或超时未就绪 父进程结束子进程并继续提供服务
+*/
+
+// 子进程就绪管道描述符的环境变量
+const readyFdEnv = "ZOO_READY_FD"
+
+// 就绪标识
+const readyMsg = "ready"
+
+// 等待子进程就绪的最长时间
+var readyTimeout = time.Second * 30
+
+// 子进程通知父进程已就绪 非热重启启动时不处理
+func notifyReady() {
+	fdStr := os.Getenv(readyFdEnv)
+	if fdStr == "" {
+		return
+	}
+	_ = os.Unsetenv(readyFdEnv) //不再传递给之后的子进程
+
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		mLog.Error("就绪管道描述符错误：", fdStr)
+		return
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	if f == nil {
+		mLog.Error("就绪管道描述符无效：", fdStr)
+		return
+	}
+	defer f.Close()
+
+	if _, err = f.Write([]byte(readyMsg)); err != nil {
+		mLog.Error("通知父进程就绪失败：", err)
+	}
+}
+
+// 等待子进程就绪 r为管道的读端 exited在子进程退出时收到结果
+// 未就绪时结束子进程
+func waitReady(cmd *exec.Cmd, r *os.File, exited <-chan error) error {
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, len(readyMsg))
+		_, err := io.ReadFull(r, buf)
+		if err == nil && string(buf) != readyMsg {
+			err = errors.New("就绪标识错误")
+		}
+		ready <- err
+	}()
+
+	timer := time.NewTimer(readyTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case err = <-ready:
+		if err == nil {
+			return nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF { //管道写端已关闭 新进程已退出
+			err = errors.New("新进程未就绪即退出")
+		} else {
+			err = errors.New("新进程未就绪：" + err.Error())
+		}
+	case e := <-exited:
+		err = errors.New("新进程已退出")
+		if e != nil {
+			err = errors.New("新进程已退出：" + e.Error())
+		}
+		return err
+	case <-timer.C:
+		err = errors.New("等待新进程就绪超时")
+	}
+
+	_ = cmd.Process.Kill()
+	_ = r.Close() //结束读取的goroutine
+
+	return err
+}
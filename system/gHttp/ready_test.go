@@ -0,0 +1,124 @@
+package gHttp
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 作为子进程运行 GHTTP_HELPER指定行为
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv("GHTTP_HELPER") {
+	case "ready":
+		notifyReady()
+		time.Sleep(5 * time.Second)
+	case "exit":
+		os.Exit(1)
+	case "sleep":
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// 启动子进程 写端作为描述符3传递 与restart一致
+func startHelper(t *testing.T, mode string) (*exec.Cmd, *os.File, chan error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Env = append(os.Environ(), "GHTTP_HELPER="+mode, readyFdEnv+"=3")
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		<-exited
+	})
+
+	return cmd, r, exited
+}
+
+func TestWaitReady(t *testing.T) {
+	cmd, r, exited := startHelper(t, "ready")
+	if err := waitReady(cmd, r, exited); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+		t.Error("ready child was killed")
+	default:
+	}
+}
+
+func TestWaitReadyExit(t *testing.T) {
+	cmd, r, exited := startHelper(t, "exit")
+	err := waitReady(cmd, r, exited)
+	if err == nil || !strings.Contains(err.Error(), "退出") {
+		t.Fatalf("got %v, want exit error", err)
+	}
+}
+
+func TestWaitReadyTimeout(t *testing.T) {
+	old := readyTimeout
+	readyTimeout = 100 * time.Millisecond
+	defer func() { readyTimeout = old }()
+
+	cmd, r, exited := startHelper(t, "sleep")
+	err := waitReady(cmd, r, exited)
+	if err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Fatalf("got %v, want timeout error", err)
+	}
+
+	//未就绪的子进程被结束
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Error("child not killed after timeout")
+	}
+	exited <- nil //供Cleanup读取
+}
+
+func TestNotifyReady(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	fd, err := syscall.Dup(int(w.Fd())) //notifyReady会关闭描述符
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(readyFdEnv, strconv.Itoa(fd))
+
+	notifyReady()
+	_ = w.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != readyMsg {
+		t.Errorf("got %q", b)
+	}
+	if os.Getenv(readyFdEnv) != "" {
+		t.Error(readyFdEnv + " not unset")
+	}
+
+	notifyReady() //非热重启时不处理
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"encoding"
+	"github.com/solaa51/zoo/system/control"
+	"github.com/solaa51/zoo/system/mLog"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+控制器方法参数绑定
+	支持 string int系列 uint系列 float bool time.Time 以及实现了encoding.TextUnmarshaler的类型
+	最后一个参数可以为 ...string 接收剩余的全部参数
+	参数转换失败返回paramError http请求返回400 rpc请求返回-32602
+	参数类型不支持返回argTypeError http请求返回500 rpc请求返回-32603 AddCompile时记录警告日志
+*/
+
+// 参数转换失败
+type paramError struct {
+	msg string
+}
+
+func (e *paramError) Error() string {
+	return e.msg
+}
+
+func newParamError(index int, value string, typeName string) *paramError {
+	return &paramError{msg: "第" + strconv.Itoa(index+1) + "个参数" + strconv.Quote(value) + "无法转换为" + typeName}
+}
+
+// 控制器方法的参数类型不支持 属于程序错误 与请求数据无关
+type argTypeError struct {
+	msg string
+}
+
+func (e *argTypeError) Error() string {
+	return e.msg
+}
+
+// time.Time支持的格式 也可传unix时间戳
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	unmarshalType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// 将路由参数转换为方法参数类型
+func bindArg(t reflect.Type, index int, value string) (reflect.Value, error) {
+	if t == timeType {
+		tm, ok := parseTime(value)
+		if !ok {
+			return reflect.Value{}, newParamError(index, value, "时间")
+		}
+		return reflect.ValueOf(tm), nil
+	}
+
+	//自定义类型
+	if reflect.PtrTo(t).Implements(unmarshalType) {
+		v := reflect.New(t)
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value)); err != nil {
+			return reflect.Value{}, &paramError{msg: "第" + strconv.Itoa(index+1) + "个参数错误:" + err.Error()}
+		}
+		return v.Elem(), nil
+	}
+
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, newParamError(index, value, "整数")
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(value, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, newParamError(index, value, "非负整数")
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, t.Bits())
+		if err != nil {
+			return reflect.Value{}, newParamError(index, value, "小数")
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return reflect.Value{}, newParamError(index, value, "布尔值")
+		}
+		v.SetBool(b)
+	default:
+		return reflect.Value{}, &argTypeError{msg: "不支持的参数类型:" + t.String()}
+	}
+
+	return v, nil
+}
+
+// 参数类型是否支持绑定
+func supportedArg(t reflect.Type) bool {
+	if t == timeType || reflect.PtrTo(t).Implements(unmarshalType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+// 检查方法的参数类型 返回第一个不支持的参数类型错误
+func checkArgTypes(mt reflect.Type) error {
+	num := mt.NumIn()
+	if mt.IsVariadic() {
+		if mt.In(num-1).Elem().Kind() != reflect.String {
+			return &argTypeError{msg: "可变参数仅支持...string"}
+		}
+		num--
+	}
+
+	for i := 0; i < num; i++ {
+		if !supportedArg(mt.In(i)) {
+			return &argTypeError{msg: "第" + strconv.Itoa(i+1) + "个参数类型不支持:" + mt.In(i).String()}
+		}
+	}
+
+	return nil
+}
+
+// 继承自control.Controller的方法 不作为控制器方法检查
+var baseType = reflect.TypeOf(&control.Controller{})
+
+// 检查控制器全部方法的参数类型 不支持的类型记录警告日志 请求时返回500
+func checkControl(className string, c control.Control) {
+	t := reflect.TypeOf(c)
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		if _, ok := baseType.MethodByName(method.Name); ok || method.Name == "PreInit" {
+			continue
+		}
+
+		//Method的类型包含接收者
+		if err := checkArgTypes(reflect.ValueOf(c).Method(i).Type()); err != nil {
+			mLog.Warn(className + "-" + method.Name + " 无法作为控制器方法调用:" + err.Error())
+		}
+	}
+}
+
+// 解析时间参数 纯数字按unix时间戳处理
+func parseTime(value string) (time.Time, bool) {
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(ts, 0), true
+	}
+
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if tm, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return tm, true
+		}
+	}
+
+	return time.Time{}, false
+}
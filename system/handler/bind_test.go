@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/solaa51/zoo/system/control"
+	"github.com/solaa51/zoo/system/router"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 实现encoding.TextUnmarshaler的自定义类型
+type level int
+
+func (l *level) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("未知等级")
+	}
+	return nil
+}
+
+type bindCtl struct {
+	control.Controller
+}
+
+func (c *bindCtl) List(page int, size uint8, ratio float64, on bool, start time.Time, lv level, tags ...string) error {
+	return c.Ctx.Json(0, strings.TrimSpace(fmt.Sprintln(page, size, ratio, on, start.Format("2006-01-02"), int(lv), tags)), "")
+}
+
+func (c *bindCtl) Struct(p struct{ Id int }) error {
+	return c.Ctx.Json(0, p.Id, "")
+}
+
+func (c *bindCtl) Slice(ids ...int) error {
+	return c.Ctx.Json(0, ids, "")
+}
+
+func newBindHandle() *MHandle {
+	h := New()
+	h.SetRouter(router.New())
+	h.SetRpcPath("/rpc")
+	h.AddCompile("bind", func() control.Control { return &bindCtl{} })
+
+	return h
+}
+
+func TestBindArgs(t *testing.T) {
+	h := newBindHandle()
+
+	tests := []struct {
+		target string
+		code   int
+		data   string
+	}{
+		{"/bind/list/1/2/0.5/true/2024-01-02/low", http.StatusOK, `"1 2 0.5 true 2024-01-02 1 []"`},
+		{"/bind/list/-1/255/1e3/0/2024-01-02 10:00:00/high/a/b", http.StatusOK, `"-1 255 1000 false 2024-01-02 2 [a b]"`},
+		{"/bind/list/1/2/0.5/1/1704153600/low", http.StatusOK, `"1 2 0.5 true ` + time.Unix(1704153600, 0).Format("2006-01-02") + ` 1 []"`},
+		{"/bind/list/a/2/0.5/true/2024-01-02/low", http.StatusBadRequest, ""},
+		{"/bind/list/1/256/0.5/true/2024-01-02/low", http.StatusBadRequest, ""},
+		{"/bind/list/1/2/x/true/2024-01-02/low", http.StatusBadRequest, ""},
+		{"/bind/list/1/2/0.5/yes/2024-01-02/low", http.StatusBadRequest, ""},
+		{"/bind/list/1/2/0.5/true/2024-13-02/low", http.StatusBadRequest, ""},
+		{"/bind/list/1/2/0.5/true/2024-01-02/mid", http.StatusBadRequest, ""},
+		{"/bind/list/1/2/0.5/true/2024-01-02", http.StatusNotFound, ""},
+		//参数类型不支持属于程序错误
+		{"/bind/struct/1", http.StatusInternalServerError, ""},
+		{"/bind/slice/1", http.StatusInternalServerError, ""},
+	}
+
+	for _, v := range tests {
+		w := serveGet(h, strings.ReplaceAll(v.target, " ", "%20"))
+		if w.Code != v.code {
+			t.Errorf("%s: status = %d body = %s", v.target, w.Code, w.Body.String())
+			continue
+		}
+		if v.data != "" && !strings.Contains(w.Body.String(), `"data":`+v.data) {
+			t.Errorf("%s: body = %s", v.target, w.Body.String())
+		}
+	}
+}
+
+func TestRpcBindArgs(t *testing.T) {
+	h := newBindHandle()
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"jsonrpc":"2.0","method":"bind.list","params":[1,2,0.5,true,"2024-01-02","high","a"],"id":1}`,
+			`{"jsonrpc":"2.0","result":{"msg":"","ret":0,"data":"1 2 0.5 true 2024-01-02 2 [a]"},"id":1}`},
+		{`{"jsonrpc":"2.0","method":"bind.list","params":[1,2,0.5,true,"2024-01-02","mid"],"id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: 第6个参数错误:未知等级"},"id":1}`},
+		{`{"jsonrpc":"2.0","method":"bind.struct","params":[1],"id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":1}`},
+	}
+
+	for _, v := range tests {
+		if got := rpcPost(h, v.body).Body.String(); got != v.want {
+			t.Errorf("%s\ngot  %s\nwant %s", v.body, got, v.want)
+		}
+	}
+}
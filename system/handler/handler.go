@@ -1,11 +1,11 @@
 package handler
 
 import (
-	"context"
 	"errors"
 	"github.com/solaa51/zoo/system/cFunc"
 	"github.com/solaa51/zoo/system/config"
 	"github.com/solaa51/zoo/system/control"
+	"github.com/solaa51/zoo/system/library/limiter"
 	"github.com/solaa51/zoo/system/mCtx"
 	"github.com/solaa51/zoo/system/mLog"
 	"github.com/solaa51/zoo/system/router"
@@ -13,35 +13,74 @@ import (
 	"os"
 	"reflect"
 	"runtime"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-var Handle = New()
+var Handle = defaultHandle()
 
 type NewControl func() control.Control
 
+// New 创建http请求处理程序 默认使用router的默认路由 可通过SetRouter指定独立的路由
 func New() *MHandle {
 	return &MHandle{
-		compile: make(map[string]NewControl, 0),
-		outTime: 10 * time.Second, //默认超时时间30秒
+		router:           router.Default(),
+		compile:          make(map[string]NewControl, 0),
+		classMiddleware:  make(map[string][]mCtx.Middleware, 0),
+		methodMiddleware: make(map[string][]mCtx.Middleware, 0),
+		routeTimeout:     make(map[string]time.Duration, 0),
+		methods:          make(map[string][]string, 0),
+		outTime:          10 * time.Second, //默认超时时间10秒 首次处理请求时读取配置文件
 	}
 }
 
+// 默认处理程序 json-rpc访问路径使用配置文件中的rpcPath
+func defaultHandle() *MHandle {
+	h := New()
+	h.rpcConfig = true
+	return h
+}
+
 // AddCompile 添加控制器的映射规则
 func AddCompile(className string, nc NewControl) {
-	Handle.compile[className] = nc
+	Handle.AddCompile(className, nc)
+}
+
+// AddCompile 添加控制器的映射规则
+func (m *MHandle) AddCompile(className string, nc NewControl) {
+	checkControl(className, nc())
+	m.compile[className] = nc
+}
+
+// SetRouter 设置请求使用的路由
+func (m *MHandle) SetRouter(r *router.Router) {
+	m.router = r
 }
 
 // MHandle http请求处理程序结构
 // 控制器必须继承control.Controller
 type MHandle struct {
+	router  *router.Router        //路由规则
 	compile map[string]NewControl //控制器映射 实例化规则
 
-	msg     string        //超时文本提示信息
-	outTime time.Duration //超时时间 默认30秒
-	ctx     context.Context
+	middleware       []mCtx.Middleware            //全局中间件
+	classMiddleware  map[string][]mCtx.Middleware //按class注册的中间件
+	methodMiddleware map[string][]mCtx.Middleware //按class/method注册的中间件
+
+	msg          string                   //超时文本提示信息
+	outTime      time.Duration            //超时时间 默认10秒 小于等于0则不限制
+	routeTimeout map[string]time.Duration //按class或class/method设置的超时时间
+	methods      map[string][]string      //按class或class/method设置允许的http请求方式
+
+	rpcPath    string    //json-rpc访问路径 为空则不开启
+	rpcConfig  bool      //是否使用配置文件中的rpcPath 默认处理程序未调用SetRpcPath时为true
+	timeoutSet bool      //是否通过SetTimeout设置过超时时间 设置后不使用配置文件中的值
+	configOnce sync.Once //首次处理请求时读取配置文件
+
+	limiterMu  sync.RWMutex
+	limiter    *limiter.Group //限流器 按配置文件中的规则创建
+	limitRules []limiter.Rule //当前限流器对应的规则
 }
 
 // 静态文件匹配
@@ -120,6 +159,14 @@ func (m *MHandle) staticFiles(r *http.Request) (string, error) {
 
 // http请求调用入口
 func (m *MHandle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.loadConfig()
+
+	//json-rpc请求
+	if m.rpcPath != "" && r.URL.Path == m.rpcPath {
+		m.serveRpc(w, r)
+		return
+	}
+
 	//处理静态文件请求
 	sFile, err := m.staticFiles(r)
 	if err != nil {
@@ -132,7 +179,12 @@ func (m *MHandle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//解析路由规则 解析出class method params
-	className, methodName, params := router.ParseRoute(r)
+	route := m.router.Match(r)
+	if route.MethodNotAllowed { //路径匹配 但规则都不允许该请求方式
+		methodNotAllowed(w, withImplicit(route.Methods))
+		return
+	}
+	className, methodName, params := route.ClassName, route.MethodName, route.Params
 	if className == "" || methodName == "" {
 		http.NotFound(w, r)
 		return
@@ -145,6 +197,13 @@ func (m *MHandle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//检查客户端证书
+	if !mCtx.ClientCertPass(r, className) {
+		mLog.Warn(cFunc.ClientIP(r) + " - " + r.RequestURI + " - " + className + "-" + methodName + " - 缺少客户端证书")
+		http.Error(w, "需要客户端证书", http.StatusForbidden)
+		return
+	}
+
 	//PreInit为前置调用，不允许外部访问
 	if strings.Index(methodName, "preInit") >= 0 || strings.Index(methodName, "PreInit") >= 0 {
 		mLog.Warn(cFunc.ClientIP(r) + " - " + r.RequestURI + " - " + className + "-" + methodName + " - IP被禁止")
@@ -160,37 +219,76 @@ func (m *MHandle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//OPTIONS请求经过中间件后自动应答 不校验method参数 不解析请求数据
+	if r.Method == http.MethodOptions {
+		m.serveOptions(w, r, route)
+		return
+	}
+
 	//handler校验method以及params
 	call, args, err := m.checkMethodParams(methodName, params, controlInterface)
 	if err != nil {
 		mLog.Warn(cFunc.ClientIP(r) + " - " + r.RequestURI + " - " + className + "-" + methodName + " - " + err.Error())
+		if _, ok := err.(*paramError); ok { //参数格式错误
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := err.(*argTypeError); ok { //控制器方法的参数类型不支持
+			http.Error(w, "请求处理异常", http.StatusInternalServerError)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+
+	//检查http请求方式
+	if !m.checkMethod(w, r, className, methodName, route.Methods) {
+		return
+	}
+
 	//记录访问日志
 	mLog.Info(cFunc.ClientIP(r) + " - " + r.RequestURI + " - " + r.Header.Get("User-Agent"))
 
-	/*//设置handler超时ctx
-	ctx := m.ctx
-	if ctx == nil {
-		var cancelCtx context.CancelFunc
-		if m.outTime <= 0 { //没有设置超时时间
-			ctx, cancelCtx = context.WithCancel(r.Context())
-		} else {
-			ctx, cancelCtx = context.WithTimeout(r.Context(), m.outTime)
-		}
-		defer cancelCtx()
-	}*/
+	//ip与route限流 在解析请求数据之前检查
+	if ok, wait := m.allowRequest(r, className, methodName); !ok {
+		mLog.Warn(cFunc.ClientIP(r) + " - " + r.RequestURI + " - " + className + "-" + methodName + " - 请求被限流")
+		tooManyRequests(w, wait)
+		return
+	}
 
-	//设置控制器 context 信息
-	cc := controlInterface.(control.Control)     //转义为 control interface
-	err = cc.SetCtx(w, r, className, methodName) //利用组合特效，设置controller的Ctx成员属性
-	if err != nil {
+	//设置控制器 context 信息 利用组合特效，设置controller的Ctx成员属性
+	if err = controlInterface.SetCtx(w, r, className, methodName); err != nil {
 		mLog.Warn(cFunc.ClientIP(r) + " - " + r.RequestURI + " - " + className + "-" + methodName + " - " + err.Error())
+		if err == mCtx.ErrBodyTooLarge {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
+	ctx := control.Con(controlInterface)
+	if ctx == nil {
+		mLog.Error(className + " 未继承control.Controller 无法取得请求上下文")
+		http.Error(w, "请求处理异常", http.StatusInternalServerError)
+		return
+	}
+	ctx.RouteParams = route.Named
+
+	//app_key限流 签名验证通过后检查
+	if ok, wait := m.allowAppKey(ctx); !ok {
+		mLog.Warn(cFunc.ClientIP(r) + " - " + r.RequestURI + " - " + className + "-" + methodName + " - 请求被限流")
+		tooManyRequests(w, wait)
+		return
+	}
 
+	//经过中间件 在超时时间内调用url所对应的方法
+	m.serve(w, ctx, controlInterface, call, args, route.Middleware)
+}
+
+// 经过注册的中间件 调用控制器方法 包含PreInit前置调用
+// JsonReturn等正常提前返回的panic视为调用完成 其他panic记录日志后返回错误
+// 控制器方法返回的error为ErrResponded或已写入返回数据时视为调用完成
+func (m *MHandle) invoke(cc control.Control, ctx *mCtx.Con, call reflect.Value, args []reflect.Value, group []mCtx.Middleware) (err error) {
 	defer func() { //处理panic 需要在调用之前声明
 		if e := recover(); e != nil {
 			switch e {
@@ -201,76 +299,55 @@ func (m *MHandle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				var buf [4096]byte
 				n := runtime.Stack(buf[:], false)
 				mLog.Error("PANIC:", string(buf[:n]))
-				http.Error(w, "请求处理异常", http.StatusBadGateway)
+				err = errors.New("请求处理异常")
 			}
 		}
 	}()
 
-	// TODO 检测是否存在"初始调用"函数 如果存在则优先调用 PreInit() 方法
-	m.checkPreInit(controlInterface)
-
-	//调用url所对应的方法
-	call.Call(args)
-
-	/*//调用方式二:
-	//处理异常panic
-	panicChan := make(chan interface{}, 1)
-	done := make(chan struct{}) //标记处理完成
-
-	// 处理请求
-	go func() {
-		defer func() {
-			if p := recover(); p != nil {
-				switch p {
-				case mCtx.JSONRETURN: //正常退出
-					panicChan <- 1
-				default: //如果想输出错误状态码 请在writer写入数据前，写入writerHeader为500等状态码  默认情况均为200状态码
-					var buf [4096]byte
-					n := runtime.Stack(buf[:], false)
-					mLog.Error("PANIC:", string(buf[:n]))
-					panicChan <- 2
-				}
-			}
-		}()
+	var callErr error
+	h := mCtx.Chain(func(c *mCtx.Con) {
+		// 检测是否存在"初始调用"函数 如果存在则优先调用 PreInit() 方法
+		if callErr = m.checkPreInit(cc); callErr != nil || c.IsAborted() {
+			return
+		}
 
-		call.Call(args)
-		close(done)
-	}()
+		callErr = resultError(call.Call(args))
+	}, m.middlewares(ctx.ClassName, ctx.MethodName, group)...)
 
-	select {
-	case p := <-panicChan: //panic信号
-		if p == 1 { //正常的panic返回 退出信号
-			responseWriter.Mu.Lock()
-			defer responseWriter.Mu.Unlock()
-			if responseWriter.Status > 0 && responseWriter.Status != 200 {
-				w.WriteHeader(responseWriter.Status)
-			}
-			if responseWriter.RetType == "json" {
-				w.Header().Set("Content-Type", "application/json;charset=UTF-8")
-			}
-			_, _ = w.Write([]byte(responseWriter.Body))
-		} else { //异常
-			w.WriteHeader(500)
-		}
-	case <-done: //正常返回 或 指定的panic返回
-		responseWriter.Mu.Lock()
-		defer responseWriter.Mu.Unlock()
-		if responseWriter.Status >= 0 {
-			w.WriteHeader(responseWriter.Status)
-		}
-		if responseWriter.RetType == "json" {
-			w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	h(ctx)
+
+	if callErr != nil && callErr != mCtx.ErrResponded {
+		mLog.Error("访问记录：["+ctx.RequestId+"] error -- "+ctx.ClassName+"/"+ctx.MethodName, callErr.Error())
+		if !ctx.Responded() {
+			return errors.New("请求处理异常")
 		}
-		_, _ = w.Write([]byte("我是自己写的输出 done信号"))
-		_, _ = w.Write([]byte(responseWriter.Body))
-	case <-ctx.Done(): //处理超时
-		w.WriteHeader(http.StatusGatewayTimeout)
-		_, _ = io.WriteString(w, m.timeoutBody())
-	}*/
+	}
+
+	return nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// 控制器方法最后一个返回值为error时 取出该error
+func resultError(out []reflect.Value) error {
+	if len(out) == 0 {
+		return nil
+	}
+
+	last := out[len(out)-1]
+	if last.Type() != errorType || last.IsNil() {
+		return nil
+	}
+
+	return last.Interface().(error)
 }
 
 //处理超时返回文本信息
 func (m *MHandle) timeoutBody() string {
+	if m.msg != "" {
+		return m.msg
+	}
+
 	return "Timeout"
 }
 
@@ -285,61 +362,61 @@ func (m *MHandle) parseCompile(className string) (control.Control, error) {
 }
 
 // 检查是否包含初始化函数，如果存在，则先调用
-func (m *MHandle) checkPreInit(control control.Control) {
+// PreInit可返回error 不为nil时不再调用控制器方法
+func (m *MHandle) checkPreInit(control control.Control) error {
 	methodName := "PreInit"
 	getType := reflect.TypeOf(control)
 	_, bol := getType.MethodByName(methodName) //判断是否存在调用的方法
 	if !bol {
-		return
+		return nil
 	}
 
 	getValue := reflect.ValueOf(control)
 	method := getValue.MethodByName(methodName)
 
-	method.Call(make([]reflect.Value, 0))
-	return
+	return resultError(method.Call(make([]reflect.Value, 0)))
 }
 
+// 控制器中不存在请求的方法
+var errMethodNotFound = errors.New("404 method not found")
+
 // 映射校验方法以及参数
 func (m *MHandle) checkMethodParams(methodName string, params []string, control control.Control) (reflect.Value, []reflect.Value, error) {
 	getType := reflect.TypeOf(control)
 	_, bol := getType.MethodByName(methodName) //判断是否存在调用的方法
 	if !bol {
-		return reflect.Value{}, nil, errors.New("404 method not found")
+		return reflect.Value{}, nil, errMethodNotFound
 	}
 
-	getValue := reflect.ValueOf(control)
+	method := reflect.ValueOf(control).MethodByName(methodName)
+	mt := method.Type()
 
-	/*//给control赋值ctx的另一种方式
-	elem := getValue.Elem()
-	elem.FieldByName("R").Set(reflect.ValueOf(r))
-	ctxStruct := elem.FieldByName("Ctx")
-	c, err := mCtx.New(r, w, className, methodName)
-	if err != nil {
+	if err := checkArgTypes(mt); err != nil {
 		return reflect.Value{}, nil, err
 	}
-	ctxStruct.Set(reflect.ValueOf(c))*/
 
-	method := getValue.MethodByName(methodName)
-	//method.Type().NumIn() //获取到参数个数
-	//method.Type().In(index) //获取指定位置的参数类型
-	args := make([]reflect.Value, method.Type().NumIn())
-	if method.Type().NumIn() > 0 {
-		if method.Type().NumIn() != len(params) {
-			//方法参数不匹配
+	//最后一个参数为...string时 接收剩余的全部参数
+	num := mt.NumIn()
+	if mt.IsVariadic() {
+		num--
+		if len(params) < num {
 			return reflect.Value{}, nil, errors.New("参数不匹配")
 		}
-		for i := 0; i < method.Type().NumIn(); i++ {
-			switch method.Type().In(i).Name() {
-			case "string":
-				args[i] = reflect.ValueOf(params[i])
-			case "int64":
-				tmpInt64, _ := strconv.ParseInt(params[i], 10, 64)
-				args[i] = reflect.ValueOf(tmpInt64)
-			default:
-				return reflect.Value{}, nil, errors.New("参数类型不匹配")
-			}
+	} else if num != len(params) {
+		//方法参数不匹配
+		return reflect.Value{}, nil, errors.New("参数不匹配")
+	}
+
+	args := make([]reflect.Value, 0, len(params))
+	for i := 0; i < num; i++ {
+		arg, err := bindArg(mt.In(i), i, params[i])
+		if err != nil {
+			return reflect.Value{}, nil, err
 		}
+		args = append(args, arg)
+	}
+	for _, v := range params[num:] {
+		args = append(args, reflect.ValueOf(v).Convert(mt.In(num).Elem()))
 	}
 
 	return method, args, nil
@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"github.com/solaa51/zoo/system/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	dir, _ := filepath.Abs("testdata/configs")
+	config.SetDir(dir)
+
+	os.Exit(m.Run())
+}
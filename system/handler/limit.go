@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"github.com/solaa51/zoo/system/cFunc"
+	"github.com/solaa51/zoo/system/config"
+	"github.com/solaa51/zoo/system/library/limiter"
+	"github.com/solaa51/zoo/system/mCtx"
+	"github.com/solaa51/zoo/system/mLog"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// 首次处理请求时读取配置文件中的超时、限流与json-rpc设置 导入包时不读取配置文件
+// 限流规则在配置文件更新时同步更新
+func (m *MHandle) loadConfig() {
+	m.configOnce.Do(func() {
+		cc := config.Info()
+		if cc.Http.Timeout > 0 && !m.timeoutSet {
+			m.outTime = time.Duration(cc.Http.Timeout) * time.Second
+		}
+		if m.msg == "" {
+			m.msg = cc.Http.TimeoutBody
+		}
+		if m.rpcConfig {
+			m.rpcPath = cc.Http.RpcPath
+		}
+
+		m.loadLimiter(cc)
+		config.OnReload(m.loadLimiter)
+	})
+}
+
+// 根据配置文件中的限流规则 创建限流器 规则变化时重建
+func (m *MHandle) loadLimiter(cc *config.Config) {
+	m.limiterMu.Lock()
+	defer m.limiterMu.Unlock()
+
+	if m.limiter != nil && reflect.DeepEqual(m.limitRules, cc.Limiter) {
+		return
+	}
+
+	g, err := limiter.NewGroup(cc.Limiter)
+	if err != nil {
+		mLog.Error("限流规则配置错误：", err)
+		return
+	}
+
+	m.limiter = g
+	m.limitRules = cc.Limiter
+}
+
+// 当前的限流器 未配置时为nil
+func (m *MHandle) currentLimiter() *limiter.Group {
+	m.limiterMu.RLock()
+	defer m.limiterMu.RUnlock()
+
+	return m.limiter
+}
+
+// 检查ip与route限流 在解析请求数据和验证签名之前调用 被限流时返回建议的等待时间
+func (m *MHandle) allowRequest(r *http.Request, className string, methodName string) (bool, time.Duration) {
+	g := m.currentLimiter()
+	if g == nil {
+		return true, 0
+	}
+
+	return g.AllowRequest(className, methodName, cFunc.ClientIP(r))
+}
+
+// 检查app_key限流 签名验证通过之后调用
+func (m *MHandle) allowAppKey(ctx *mCtx.Con) (bool, time.Duration) {
+	g := m.currentLimiter()
+	if g == nil {
+		return true, 0
+	}
+
+	return g.AllowAppKey(ctx.ClassName, ctx.MethodName, ctx.CommonParam.AppKey)
+}
+
+// 返回429 并通过Retry-After告知等待的秒数
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	sec := int64(math.Ceil(wait.Seconds()))
+	if sec < 1 {
+		sec = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.FormatInt(sec, 10))
+	http.Error(w, "429 too many requests", http.StatusTooManyRequests)
+}
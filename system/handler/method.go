@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"github.com/solaa51/zoo/system/mCtx"
+	"github.com/solaa51/zoo/system/mLog"
+	"github.com/solaa51/zoo/system/router"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// 未限制请求方式时 OPTIONS返回的Allow
+var defaultAllow = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// SetMethods 设置控制器class或method允许的http请求方式 methodName为空则作用于整个class
+func SetMethods(className string, methodName string, methods ...string) {
+	Handle.SetMethods(className, methodName, methods...)
+}
+
+// SetMethods 设置控制器class或method允许的http请求方式 methodName为空则作用于整个class
+func (m *MHandle) SetMethods(className string, methodName string, methods ...string) {
+	ms := make([]string, 0, len(methods))
+	for _, v := range methods {
+		ms = append(ms, strings.ToUpper(strings.TrimSpace(v)))
+	}
+
+	m.methods[methodKey(className, methodName)] = ms
+}
+
+// 计算请求允许的http请求方式 路由规则与控制器的限制同时存在时取交集
+// 返回nil表示不限制
+func (m *MHandle) allowMethods(className string, methodName string, routeMethods []string) []string {
+	ms, ok := m.methods[methodKey(className, methodName)]
+	if !ok {
+		ms, ok = m.methods[methodKey(className, "")]
+	}
+
+	var allow []string
+	switch {
+	case !ok && len(routeMethods) == 0:
+		return nil
+	case !ok:
+		allow = routeMethods
+	case len(routeMethods) == 0:
+		allow = ms
+	default:
+		allow = make([]string, 0)
+		for _, v := range ms {
+			if hasMethod(routeMethods, v) {
+				allow = append(allow, v)
+			}
+		}
+	}
+
+	return withImplicit(allow)
+}
+
+// 允许GET时同时允许HEAD 始终允许OPTIONS
+func withImplicit(allow []string) []string {
+	ret := make([]string, 0, len(allow)+2)
+	ret = append(ret, allow...)
+	if hasMethod(ret, http.MethodGet) && !hasMethod(ret, http.MethodHead) {
+		ret = append(ret, http.MethodHead)
+	}
+	if !hasMethod(ret, http.MethodOptions) {
+		ret = append(ret, http.MethodOptions)
+	}
+
+	return ret
+}
+
+// 检查请求方式 不允许的请求方式返回405
+// 返回false表示请求已处理完成
+func (m *MHandle) checkMethod(w http.ResponseWriter, r *http.Request, className string, methodName string, routeMethods []string) bool {
+	allow := m.allowMethods(className, methodName, routeMethods)
+	if allow != nil && !hasMethod(allow, r.Method) {
+		methodNotAllowed(w, allow)
+		return false
+	}
+
+	return true
+}
+
+// 返回405 并通过Allow告知允许的请求方式
+func methodNotAllowed(w http.ResponseWriter, allow []string) {
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+}
+
+// OPTIONS请求经过中间件后自动应答 中间件可自行应答(如跨域预检)或中断请求
+// 不解析请求数据 不验证签名
+func (m *MHandle) serveOptions(w http.ResponseWriter, r *http.Request, route *router.Route) {
+	allow := m.allowMethods(route.ClassName, route.MethodName, route.Methods)
+	if allow == nil {
+		allow = defaultAllow
+	}
+
+	ctx := mCtx.NewLite(w, r, route.ClassName, route.MethodName)
+	ctx.RouteParams = route.Named
+
+	defer func() {
+		if e := recover(); e != nil && e != mCtx.JSONRETURN && e != mCtx.TEXTRETURN {
+			var buf [4096]byte
+			n := runtime.Stack(buf[:], false)
+			mLog.Error("PANIC:", string(buf[:n]))
+			http.Error(w, "请求处理异常", http.StatusBadGateway)
+		}
+	}()
+
+	h := mCtx.Chain(func(c *mCtx.Con) {
+		if c.Responded() {
+			return
+		}
+		c.ResponseWriter.Header().Set("Allow", strings.Join(allow, ", "))
+		c.ResponseWriter.WriteHeader(http.StatusNoContent)
+	}, m.middlewares(route.ClassName, route.MethodName, route.Middleware)...)
+
+	h(ctx)
+}
+
+func hasMethod(methods []string, method string) bool {
+	for _, v := range methods {
+		if v == method {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"github.com/solaa51/zoo/system/control"
+	"github.com/solaa51/zoo/system/mCtx"
+	"github.com/solaa51/zoo/system/router"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type userCtl struct {
+	control.Controller
+}
+
+func (c *userCtl) Info(id int64) error {
+	return c.Ctx.Json(0, id, "info")
+}
+
+func (c *userCtl) Update(id int64) error {
+	return c.Ctx.Json(0, id, "update")
+}
+
+func newMethodHandle() *MHandle {
+	rt := router.New()
+	rt.AddCompile(`member/(\d+)`, "user/info/$1", "GET")
+	rt.AddCompile(`member/(\d+)`, "user/update/$1", "PUT")
+
+	h := New()
+	h.SetRouter(rt)
+	h.AddCompile("user", func() control.Control { return &userCtl{} })
+
+	return h
+}
+
+func serveMethod(h http.Handler, method string, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+
+	return w
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	h := newMethodHandle()
+
+	if w := serveMethod(h, http.MethodPut, "/member/1"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"msg":"update"`) {
+		t.Errorf("PUT: status = %d body = %s", w.Code, w.Body.String())
+	}
+
+	//路径匹配但请求方式都不允许
+	w := serveMethod(h, http.MethodDelete, "/member/1")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("DELETE: status = %d", w.Code)
+	}
+	if got := w.Header().Get("Allow"); got != "GET, PUT, HEAD, OPTIONS" {
+		t.Errorf("DELETE: Allow = %q", got)
+	}
+
+	//控制器限制的请求方式
+	h.SetMethods("user", "info", "post")
+	w = serveMethod(h, http.MethodGet, "/user/info/1")
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST, OPTIONS" {
+		t.Errorf("SetMethods: status = %d Allow = %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	//路由规则与控制器的限制取交集
+	h.SetMethods("user", "info", "GET", "POST")
+	w = serveMethod(h, http.MethodPost, "/member/1")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("intersection: status = %d", w.Code)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	h := newMethodHandle()
+
+	w := serveMethod(h, http.MethodOptions, "/member/1")
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, PUT, HEAD, OPTIONS" {
+		t.Errorf("route: status = %d Allow = %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	//不限制请求方式
+	w = serveMethod(h, http.MethodOptions, "/user/info/1")
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != strings.Join(defaultAllow, ", ") {
+		t.Errorf("default: status = %d Allow = %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	//OPTIONS不校验method参数 参数数量不符时同样应答
+	if w = serveMethod(h, http.MethodOptions, "/user/info"); w.Code != http.StatusNoContent {
+		t.Errorf("missing params: status = %d body = %s", w.Code, w.Body.String())
+	}
+	if w = serveMethod(h, http.MethodOptions, "/user/info/abc"); w.Code != http.StatusNoContent {
+		t.Errorf("bad params: status = %d body = %s", w.Code, w.Body.String())
+	}
+
+	//中间件可自行应答跨域预检
+	h.Use(func(next mCtx.HandlerFunc) mCtx.HandlerFunc {
+		return func(c *mCtx.Con) {
+			if c.Request.Method == http.MethodOptions {
+				c.ResponseWriter.Header().Set("Access-Control-Allow-Origin", "*")
+				c.ResponseWriter.WriteHeader(http.StatusOK)
+				return
+			}
+			next(c)
+		}
+	})
+	w = serveMethod(h, http.MethodOptions, "/member/1")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Allow") != "" {
+		t.Errorf("cors: status = %d header = %v", w.Code, w.Header())
+	}
+}
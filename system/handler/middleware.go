@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"github.com/solaa51/zoo/system/mCtx"
+	"strings"
+)
+
+// Use 注册全局中间件 对所有控制器方法生效
+func Use(mws ...mCtx.Middleware) {
+	Handle.Use(mws...)
+}
+
+// UseClass 注册作用于指定class的中间件
+func UseClass(className string, mws ...mCtx.Middleware) {
+	Handle.UseClass(className, mws...)
+}
+
+// UseMethod 注册作用于指定class下method的中间件
+func UseMethod(className string, methodName string, mws ...mCtx.Middleware) {
+	Handle.UseMethod(className, methodName, mws...)
+}
+
+// Use 注册全局中间件 对所有控制器方法生效
+func (m *MHandle) Use(mws ...mCtx.Middleware) {
+	m.middleware = append(m.middleware, mws...)
+}
+
+// UseClass 注册作用于指定class的中间件
+func (m *MHandle) UseClass(className string, mws ...mCtx.Middleware) {
+	m.classMiddleware[className] = append(m.classMiddleware[className], mws...)
+}
+
+// UseMethod 注册作用于指定class下method的中间件
+func (m *MHandle) UseMethod(className string, methodName string, mws ...mCtx.Middleware) {
+	key := methodKey(className, methodName)
+	m.methodMiddleware[key] = append(m.methodMiddleware[key], mws...)
+}
+
+// 按 全局 路由分组 class method 的顺序返回请求需要经过的中间件
+func (m *MHandle) middlewares(className string, methodName string, group []mCtx.Middleware) []mCtx.Middleware {
+	mws := make([]mCtx.Middleware, 0, len(m.middleware)+len(group))
+	mws = append(mws, m.middleware...)
+	mws = append(mws, group...)
+	mws = append(mws, m.classMiddleware[className]...)
+	mws = append(mws, m.methodMiddleware[methodKey(className, methodName)]...)
+
+	return mws
+}
+
+// class与method组合的key method首字母统一为大写 与路由解析结果一致
+func methodKey(className string, methodName string) string {
+	if methodName != "" {
+		methodName = strings.ToUpper(methodName[:1]) + methodName[1:]
+	}
+
+	return className + "/" + methodName
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"github.com/solaa51/zoo/system/control"
+	"github.com/solaa51/zoo/system/mCtx"
+	"github.com/solaa51/zoo/system/router"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type mwCtl struct {
+	control.Controller
+	trace *[]string
+}
+
+func (c *mwCtl) SetCtx(w http.ResponseWriter, r *http.Request, className string, methodName string) error {
+	*c.trace = append(*c.trace, "SetCtx")
+	return c.Controller.SetCtx(w, r, className, methodName)
+}
+
+func (c *mwCtl) PreInit() error {
+	*c.trace = append(*c.trace, "PreInit")
+	if c.Ctx.GetPost.Get("deny") != "" {
+		return c.Ctx.Json(403, "", "denied")
+	}
+	return nil
+}
+
+func (c *mwCtl) Index() error {
+	*c.trace = append(*c.trace, "Index")
+	return c.Ctx.Json(0, "", "ok")
+}
+
+func (c *mwCtl) Other() {
+	*c.trace = append(*c.trace, "Other")
+	c.Ctx.JsonReturn(0, "", "other")
+}
+
+func (c *mwCtl) Fail() error {
+	return errors.New("fail")
+}
+
+func (c *mwCtl) Boom() {
+	panic("boom")
+}
+
+// 记录执行顺序的中间件
+func traceMw(trace *[]string, name string) mCtx.Middleware {
+	return func(next mCtx.HandlerFunc) mCtx.HandlerFunc {
+		return func(c *mCtx.Con) {
+			*trace = append(*trace, name)
+			if c.GetPost.Get("abort") == name {
+				_ = c.AbortWithJson(401, "", "abort")
+			}
+			next(c)
+			*trace = append(*trace, "/"+name)
+		}
+	}
+}
+
+func newMwHandle(trace *[]string) *MHandle {
+	rt := router.New()
+	g := rt.Group("g", traceMw(trace, "group"))
+	g.AddCompile(`mw/(\w+)`, "/mw/$1")
+
+	h := New()
+	h.SetRouter(rt)
+	h.AddCompile("mw", func() control.Control { return &mwCtl{trace: trace} })
+	h.Use(traceMw(trace, "global"))
+	h.UseClass("mw", traceMw(trace, "class"))
+	h.UseMethod("mw", "index", traceMw(trace, "method"))
+
+	return h
+}
+
+func serveGet(h http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+	return w
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	tests := []struct {
+		target string
+		trace  string
+		body   string
+	}{
+		{"/mw/index", "SetCtx global class method PreInit Index /method /class /global", "ok"},
+		{"/mw/other", "SetCtx global class PreInit Other", "other"},
+		{"/g/mw/index", "SetCtx global group class method PreInit Index /method /class /group /global", "ok"},
+		{"/mw/index?abort=class", "SetCtx global class /class /global", "abort"},
+		{"/mw/index?deny=1", "SetCtx global class method PreInit /method /class /global", "denied"},
+	}
+
+	for _, tt := range tests {
+		var trace []string
+		w := serveGet(newMwHandle(&trace), tt.target)
+
+		if got := strings.Join(trace, " "); got != tt.trace {
+			t.Errorf("%s: trace = %s\nwant    %s", tt.target, got, tt.trace)
+		}
+		if !strings.Contains(w.Body.String(), `"msg":"`+tt.body+`"`) {
+			t.Errorf("%s: body = %s", tt.target, w.Body.String())
+		}
+	}
+}
+
+func TestInvokeError(t *testing.T) {
+	var trace []string
+	h := newMwHandle(&trace)
+
+	for _, target := range []string{"/mw/fail", "/mw/boom"} {
+		w := serveGet(h, target)
+		if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "请求处理异常") {
+			t.Errorf("%s: status = %d body = %s", target, w.Code, w.Body.String())
+		}
+	}
+}
+
+// 未继承control.Controller的控制器
+type noCtxCtl struct{}
+
+func (c *noCtxCtl) SetCtx(w http.ResponseWriter, r *http.Request, className string, methodName string) error {
+	return nil
+}
+
+func (c *noCtxCtl) Index() {}
+
+func TestControllerWithoutCtx(t *testing.T) {
+	h := New()
+	h.SetRouter(router.New())
+	h.AddCompile("noctx", func() control.Control { return &noCtxCtl{} })
+
+	if w := serveGet(h, "/noctx/index"); w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
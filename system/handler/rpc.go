@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/solaa51/zoo/system/cFunc"
+	"github.com/solaa51/zoo/system/config"
+	"github.com/solaa51/zoo/system/control"
+	"github.com/solaa51/zoo/system/mCtx"
+	"github.com/solaa51/zoo/system/mLog"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+/**
+json-rpc 2.0 服务
+与http服务共用同一个监听 默认处理程序的请求路径由配置文件中的 http.rpcPath 指定
+handler.New()创建的处理程序通过SetRpcPath单独开启
+method格式为 "class.Method" 映射到handler.AddCompile注册的控制器
+支持批量调用 以及不需要返回的通知调用(不包含id)
+*/
+
+// json-rpc 2.0 标准错误码
+const (
+	rpcParseError     = -32700 //json解析失败
+	rpcInvalidRequest = -32600 //无效的请求结构
+	rpcMethodNotFound = -32601 //方法不存在
+	rpcInvalidParams  = -32602 //参数错误
+	rpcInternalError  = -32603 //内部错误
+	rpcServerError    = -32000 //服务端拒绝 IP、签名等校验失败 以及控制器返回的ret不为0
+)
+
+// rpc请求结构
+type rpcRequest struct {
+	JsonRpc string              `json:"jsonrpc"`
+	Method  string              `json:"method"`
+	Params  jsoniter.RawMessage `json:"params"`
+	Id      jsoniter.RawMessage `json:"id"` //不包含id时为通知调用 不返回结果
+}
+
+// rpc错误信息
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// rpc返回结构
+type rpcResponse struct {
+	JsonRpc string              `json:"jsonrpc"`
+	Result  jsoniter.RawMessage `json:"result,omitempty"`
+	Error   *rpcError           `json:"error,omitempty"`
+	Id      jsoniter.RawMessage `json:"id"`
+}
+
+var rpcNull = jsoniter.RawMessage("null")
+
+func newRpcError(id jsoniter.RawMessage, code int, msg string) *rpcResponse {
+	if len(id) == 0 {
+		id = rpcNull
+	}
+
+	return &rpcResponse{
+		JsonRpc: "2.0",
+		Error:   &rpcError{Code: code, Message: msg},
+		Id:      id,
+	}
+}
+
+// SetRpcPath 设置默认处理程序的json-rpc访问路径 为空则不开启
+func SetRpcPath(path string) {
+	Handle.SetRpcPath(path)
+}
+
+// SetRpcPath 设置json-rpc访问路径 为空则不开启
+// 默认处理程序未设置时使用配置文件中的rpcPath New创建的处理程序默认不开启
+func (m *MHandle) SetRpcPath(path string) {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	m.rpcPath = path
+	m.rpcConfig = false
+}
+
+// rpcWriter 收集控制器写入的数据 作为rpc调用的结果
+type rpcWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRpcWriter() *rpcWriter {
+	return &rpcWriter{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (w *rpcWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *rpcWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *rpcWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+}
+
+// json-rpc请求入口
+func (m *MHandle) serveRpc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mCtx.LimitBody(w, r)
+	body, err := ioutil.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if mCtx.BodyTooLarge(err) {
+		http.Error(w, mCtx.ErrBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		mLog.Error("获取rpc body数据失败", err)
+		http.Error(w, "读取请求数据失败", http.StatusBadRequest)
+		return
+	}
+
+	mLog.Info(cFunc.ClientIP(r) + " - " + r.RequestURI + " - rpc - " + r.Header.Get("User-Agent"))
+
+	//header签名对整个请求body生效
+	auth, err := mCtx.HeaderAuth(r, body)
+	body = bytes.TrimSpace(body)
+
+	var ret interface{}
+	if err != nil {
+		mLog.Warn(cFunc.ClientIP(r) + " - " + r.RequestURI + " - rpc - " + err.Error())
+		ret = newRpcError(nil, rpcServerError, err.Error())
+	} else if !json.Valid(body) { //jsoniter.Valid无法识别末尾的数字
+		ret = newRpcError(nil, rpcParseError, "Parse error")
+	} else if body[0] == '[' { //批量调用
+		batch := make([]jsoniter.RawMessage, 0)
+		_ = jsoniter.Unmarshal(body, &batch)
+		if len(batch) == 0 {
+			ret = newRpcError(nil, rpcInvalidRequest, "Invalid Request")
+		} else {
+			//整个批量调用共用一个截止时间 不按调用次数累加
+			if m.outTime > 0 {
+				bCtx, cancel := context.WithTimeout(r.Context(), m.outTime)
+				defer cancel()
+				r = r.WithContext(bCtx)
+			}
+
+			list := make([]*rpcResponse, 0, len(batch))
+			for _, v := range batch {
+				if resp := m.rpcCall(r, v, auth); resp != nil {
+					list = append(list, resp)
+				}
+			}
+			if len(list) > 0 {
+				ret = list
+			}
+		}
+	} else {
+		if resp := m.rpcCall(r, body, auth); resp != nil {
+			ret = resp
+		}
+	}
+
+	//全部为通知调用 不返回任何内容
+	if ret == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	b, err := jsoniter.Marshal(ret)
+	if err != nil {
+		mLog.Error("rpc返回数据序列化失败", err)
+		http.Error(w, "请求处理异常", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	_, _ = w.Write(b)
+}
+
+// 处理单个rpc调用 通知调用返回nil
+func (m *MHandle) rpcCall(r *http.Request, raw jsoniter.RawMessage, auth *mCtx.CommonParam) *rpcResponse {
+	req := &rpcRequest{}
+	if err := jsoniter.Unmarshal(raw, req); err != nil {
+		return newRpcError(nil, rpcInvalidRequest, "Invalid Request")
+	}
+
+	//无效的请求结构 即使不包含id也需要返回错误 id无法识别时为null
+	if req.JsonRpc != "2.0" || req.Method == "" {
+		return newRpcError(validId(req.Id), rpcInvalidRequest, "Invalid Request")
+	}
+	if len(req.Id) > 0 && validId(req.Id) == nil {
+		return newRpcError(nil, rpcInvalidRequest, "Invalid Request")
+	}
+
+	resp := m.rpcDispatch(r, req, auth)
+	if len(req.Id) == 0 { //通知调用
+		return nil
+	}
+
+	return resp
+}
+
+// id只允许为字符串、数字或null 其他类型返回nil
+func validId(id jsoniter.RawMessage) jsoniter.RawMessage {
+	if len(id) == 0 {
+		return nil
+	}
+
+	switch jsoniter.Get(id).ValueType() {
+	case jsoniter.StringValue, jsoniter.NumberValue, jsoniter.NilValue:
+		return id
+	}
+
+	return nil
+}
+
+// 将rpc调用分发到控制器
+func (m *MHandle) rpcDispatch(r *http.Request, req *rpcRequest, auth *mCtx.CommonParam) *rpcResponse {
+	//解析出class method
+	i := strings.LastIndex(req.Method, ".")
+	if i <= 0 || i == len(req.Method)-1 {
+		return newRpcError(req.Id, rpcMethodNotFound, "Method not found")
+	}
+	className := req.Method[:i]
+	methodName := strings.ToUpper(req.Method[i+1:i+2]) + req.Method[i+2:]
+
+	//PreInit为前置调用，不允许外部访问
+	if strings.Index(methodName, "PreInit") >= 0 {
+		return newRpcError(req.Id, rpcMethodNotFound, "Method not found")
+	}
+
+	//检查IP 是否允许通过
+	if !config.IpPassCheck(cFunc.ClientIP(r), className) {
+		mLog.Warn(cFunc.ClientIP(r) + " - rpc - " + className + "-" + methodName + " - IP被禁止")
+		return newRpcError(req.Id, rpcServerError, cFunc.ClientIP(r)+"被禁止")
+	}
+
+	//检查客户端证书
+	if !mCtx.ClientCertPass(r, className) {
+		mLog.Warn(cFunc.ClientIP(r) + " - rpc - " + className + "-" + methodName + " - 缺少客户端证书")
+		return newRpcError(req.Id, rpcServerError, "需要客户端证书")
+	}
+
+	//参数 数组按位置映射为方法参数 对象作为业务参数
+	params := make([]string, 0)
+	if len(req.Params) > 0 {
+		switch req.Params[0] {
+		case '[':
+			list := make([]jsoniter.RawMessage, 0)
+			if err := jsoniter.Unmarshal(req.Params, &list); err != nil {
+				return newRpcError(req.Id, rpcInvalidParams, "Invalid params")
+			}
+			for _, v := range list {
+				var s string
+				if len(v) > 0 && v[0] == '"' {
+					if err := jsoniter.Unmarshal(v, &s); err != nil {
+						return newRpcError(req.Id, rpcInvalidParams, "Invalid params")
+					}
+				} else {
+					s = string(v)
+				}
+				params = append(params, s)
+			}
+		case '{', 'n':
+		default:
+			return newRpcError(req.Id, rpcInvalidParams, "Invalid params")
+		}
+	}
+
+	controlInterface, err := m.parseCompile(className)
+	if err != nil {
+		return newRpcError(req.Id, rpcMethodNotFound, "Method not found")
+	}
+
+	call, args, err := m.checkMethodParams(methodName, params, controlInterface)
+	if err != nil {
+		if err == errMethodNotFound {
+			return newRpcError(req.Id, rpcMethodNotFound, "Method not found")
+		}
+		if _, ok := err.(*argTypeError); ok {
+			mLog.Error(className + "-" + methodName + " - " + err.Error())
+			return newRpcError(req.Id, rpcInternalError, "Internal error")
+		}
+		return newRpcError(req.Id, rpcInvalidParams, "Invalid params: "+err.Error())
+	}
+
+	//rpc调用均为POST 控制器限制了请求方式且不允许POST时拒绝
+	if allow := m.allowMethods(className, methodName, nil); allow != nil && !hasMethod(allow, http.MethodPost) {
+		mLog.Warn(cFunc.ClientIP(r) + " - rpc - " + className + "-" + methodName + " - 请求方式不允许")
+		return newRpcError(req.Id, rpcServerError, "405 method not allowed")
+	}
+
+	if ok, _ := m.allowRequest(r, className, methodName); !ok {
+		mLog.Warn(cFunc.ClientIP(r) + " - rpc - " + className + "-" + methodName + " - 请求被限流")
+		return newRpcError(req.Id, rpcServerError, "429 too many requests")
+	}
+
+	//批量调用已超时 不再调用之后的方法
+	if r.Context().Err() != nil {
+		return newRpcError(req.Id, rpcServerError, m.timeoutBody())
+	}
+
+	rw := newRpcWriter()
+	ctx, err := mCtx.NewRpc(rw, r, className, methodName, req.Params, auth)
+	if err != nil {
+		mLog.Warn(cFunc.ClientIP(r) + " - rpc - " + className + "-" + methodName + " - " + err.Error())
+		return newRpcError(req.Id, rpcServerError, err.Error())
+	}
+	//rpc的请求上下文已构建 不经过控制器的SetCtx
+	if !control.SetCon(controlInterface, ctx) {
+		mLog.Error(className + " 未继承control.Controller 无法设置请求上下文")
+		return newRpcError(req.Id, rpcInternalError, "Internal error")
+	}
+
+	if ok, _ := m.allowAppKey(ctx); !ok {
+		mLog.Warn(cFunc.ClientIP(r) + " - rpc - " + className + "-" + methodName + " - 请求被限流")
+		return newRpcError(req.Id, rpcServerError, "429 too many requests")
+	}
+
+	//经过class所属路由分组的中间件
+	m.serve(rw, ctx, controlInterface, call, args, m.router.ClassMiddleware(className))
+
+	if rw.status == http.StatusGatewayTimeout {
+		return newRpcError(req.Id, rpcServerError, m.timeoutBody())
+	}
+	if rw.status >= http.StatusBadRequest {
+		return newRpcError(req.Id, rpcInternalError, strings.TrimSpace(rw.body.String()))
+	}
+
+	//Json Render返回的ret不为0时 作为错误返回
+	if res := ctx.Result(); res != nil && res.Ret != 0 {
+		resp := newRpcError(req.Id, rpcServerError, res.Msg)
+		if s, ok := res.Data.(string); !ok || s != "" {
+			resp.Error.Data = res.Data
+		}
+		return resp
+	}
+
+	//控制器输出的json数据直接作为结果 非json数据按字符串返回
+	result := jsoniter.RawMessage(bytes.TrimSpace(rw.body.Bytes()))
+	if len(result) == 0 {
+		result = rpcNull
+	} else if !json.Valid(result) {
+		result, _ = jsoniter.Marshal(rw.body.String())
+	}
+
+	return &rpcResponse{
+		JsonRpc: "2.0",
+		Result:  result,
+		Id:      req.Id,
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"github.com/solaa51/zoo/system/control"
+	"github.com/solaa51/zoo/system/router"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type rpcCalc struct {
+	control.Controller
+}
+
+func (c *rpcCalc) Add(a int64, b int64) error {
+	return c.Ctx.Json(0, a+b, "ok")
+}
+
+func (c *rpcCalc) Echo() error {
+	return c.Ctx.Json(0, c.Ctx.YewuParam, "")
+}
+
+func (c *rpcCalc) Fail() error {
+	return c.Ctx.Json(1001, map[string]int{"left": 2}, "余额不足")
+}
+
+func (c *rpcCalc) Plain() error {
+	return c.Ctx.Json(1002, "", "参数错误")
+}
+
+func newRpcHandle() *MHandle {
+	h := New()
+	h.SetRouter(router.New())
+	h.SetRpcPath("rpc")
+	h.AddCompile("calc", func() control.Control { return &rpcCalc{} })
+
+	return h
+}
+
+func rpcPost(h http.Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+
+	return w
+}
+
+func TestRpc(t *testing.T) {
+	h := newRpcHandle()
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"call", `{"jsonrpc":"2.0","method":"calc.add","params":[1,2],"id":1}`,
+			`{"jsonrpc":"2.0","result":{"msg":"ok","ret":0,"data":3},"id":1}`},
+		{"string id", `{"jsonrpc":"2.0","method":"calc.add","params":["1","2"],"id":"a"}`,
+			`{"jsonrpc":"2.0","result":{"msg":"ok","ret":0,"data":3},"id":"a"}`},
+		{"named params", `{"jsonrpc":"2.0","method":"calc.echo","params":{"a":1},"id":1}`,
+			`{"jsonrpc":"2.0","result":{"msg":"","ret":0,"data":{"a":1}},"id":1}`},
+		{"ret error", `{"jsonrpc":"2.0","method":"calc.fail","id":2}`,
+			`{"jsonrpc":"2.0","error":{"code":-32000,"message":"余额不足","data":{"left":2}},"id":2}`},
+		{"ret error without data", `{"jsonrpc":"2.0","method":"calc.plain","id":2}`,
+			`{"jsonrpc":"2.0","error":{"code":-32000,"message":"参数错误"},"id":2}`},
+		{"parse error", `{"jsonrpc":`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`},
+		{"empty batch", `[]`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`},
+		{"not an object", `1`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`},
+		{"wrong version", `{"jsonrpc":"1.0","method":"calc.add","id":3}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":3}`},
+		{"missing method", `{"jsonrpc":"2.0","id":3}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":3}`},
+		{"invalid id", `{"jsonrpc":"2.0","method":"calc.add","id":{}}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`},
+		{"invalid request without id", `{"jsonrpc":"2.0","method":""}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`},
+		{"method not found", `{"jsonrpc":"2.0","method":"calc.nope","id":4}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":4}`},
+		{"class not found", `{"jsonrpc":"2.0","method":"nope.add","id":4}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":4}`},
+		{"pre init", `{"jsonrpc":"2.0","method":"calc.preInit","id":4}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":4}`},
+		{"invalid params", `{"jsonrpc":"2.0","method":"calc.add","params":5,"id":5}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"},"id":5}`},
+		{"batch", `[{"jsonrpc":"2.0","method":"calc.add","params":[1,2],"id":1},{"jsonrpc":"2.0","method":"calc.add","params":[1,2]},{"id":2}]`,
+			`[{"jsonrpc":"2.0","result":{"msg":"ok","ret":0,"data":3},"id":1},{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":2}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := rpcPost(h, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("body = %s\nwant   %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRpcInvalidParamsType(t *testing.T) {
+	w := rpcPost(newRpcHandle(), `{"jsonrpc":"2.0","method":"calc.add","params":["x",2],"id":1}`)
+	if !strings.HasPrefix(w.Body.String(), `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: `) {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
+
+func TestRpcNotification(t *testing.T) {
+	h := newRpcHandle()
+
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","method":"calc.add","params":[1,2]}`,
+		`[{"jsonrpc":"2.0","method":"calc.add","params":[1,2]},{"jsonrpc":"2.0","method":"calc.fail"}]`,
+	} {
+		w := rpcPost(h, body)
+		if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+			t.Errorf("%s: status = %d body = %q, want 204 without body", body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRpcMethod(t *testing.T) {
+	w := httptest.NewRecorder()
+	newRpcHandle().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("status = %d Allow = %q, want 405 POST", w.Code, w.Header().Get("Allow"))
+	}
+
+	//限制为GET的方法不能通过rpc调用
+	h := newRpcHandle()
+	h.SetMethods("calc", "add", http.MethodGet)
+	want := `{"jsonrpc":"2.0","error":{"code":-32000,"message":"405 method not allowed"},"id":1}`
+	if got := rpcPost(h, `{"jsonrpc":"2.0","method":"calc.add","params":[1,2],"id":1}`).Body.String(); got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
+
+func TestRpcPath(t *testing.T) {
+	//New创建的处理程序未设置rpcPath时不开启
+	h := New()
+	h.SetRouter(router.New())
+	h.AddCompile("calc", func() control.Control { return &rpcCalc{} })
+
+	w := rpcPost(h, `{"jsonrpc":"2.0","method":"calc.add","params":[1,2],"id":1}`)
+	if strings.Contains(w.Body.String(), "jsonrpc") {
+		t.Errorf("rpc served without rpcPath: %s", w.Body.String())
+	}
+
+	h.SetRpcPath("/rpc")
+	w = rpcPost(h, `{"jsonrpc":"2.0","method":"calc.add","params":[1,2],"id":1}`)
+	if !strings.Contains(w.Body.String(), `"result"`) {
+		t.Errorf("rpc not served after SetRpcPath: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/solaa51/zoo/system/control"
+	"github.com/solaa51/zoo/system/mCtx"
+	"github.com/solaa51/zoo/system/mLog"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// SetTimeout 设置全局的请求处理超时时间 小于等于0则不限制
+func SetTimeout(d time.Duration) {
+	Handle.SetTimeout(d)
+}
+
+// SetRouteTimeout 设置指定class或method的超时时间 methodName为空则作用于整个class
+// 小于等于0则该路由不限制超时
+func SetRouteTimeout(className string, methodName string, d time.Duration) {
+	Handle.SetRouteTimeout(className, methodName, d)
+}
+
+// SetTimeoutBody 设置超时返回的内容
+func SetTimeoutBody(body string) {
+	Handle.SetTimeoutBody(body)
+}
+
+// SetTimeout 设置全局的请求处理超时时间 小于等于0则不限制
+func (m *MHandle) SetTimeout(d time.Duration) {
+	m.outTime = d
+	m.timeoutSet = true
+}
+
+// SetRouteTimeout 设置指定class或method的超时时间 methodName为空则作用于整个class
+// 小于等于0则该路由不限制超时
+func (m *MHandle) SetRouteTimeout(className string, methodName string, d time.Duration) {
+	m.routeTimeout[methodKey(className, methodName)] = d
+}
+
+// SetTimeoutBody 设置超时返回的内容
+func (m *MHandle) SetTimeoutBody(body string) {
+	m.msg = body
+}
+
+// 获取请求的超时时间 优先级 method > class > 全局
+func (m *MHandle) timeout(className string, methodName string) time.Duration {
+	if d, ok := m.routeTimeout[methodKey(className, methodName)]; ok {
+		return d
+	}
+
+	if d, ok := m.routeTimeout[methodKey(className, "")]; ok {
+		return d
+	}
+
+	return m.outTime
+}
+
+// 在超时时间内调用控制器方法
+// 控制器的输出先写入缓冲 正常完成后再写入response 超时则返回504
+// 控制器可通过Ctx.Context()感知超时与客户端断开
+func (m *MHandle) serve(w http.ResponseWriter, ctx *mCtx.Con, cc control.Control, call reflect.Value, args []reflect.Value, group []mCtx.Middleware) {
+	d := m.timeout(ctx.ClassName, ctx.MethodName)
+
+	//请求已有更早的截止时间 如rpc批量调用共用的截止时间
+	if dl, ok := ctx.Context().Deadline(); ok {
+		if rem := time.Until(dl); d <= 0 || rem < d {
+			d = rem
+			if d <= 0 {
+				d = time.Nanosecond
+			}
+		}
+	}
+
+	if d <= 0 {
+		if err := m.invoke(cc, ctx, call, args, group); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+
+	tCtx := newDeadlineCtx(ctx.Context(), d)
+	defer tCtx.cancel()
+	ctx.SetContext(tCtx)
+
+	tw := &timeoutWriter{
+		w:        w,
+		h:        make(http.Header),
+		onStream: tCtx.stop,
+	}
+	ctx.ResponseWriter = tw
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.invoke(cc, ctx, call, args, group)
+	}()
+
+	select {
+	case err := <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+
+		if tw.streaming { //流式返回或websocket 数据已直接写入
+			return
+		}
+
+		dst := w.Header()
+		for k, v := range tw.h {
+			dst[k] = v
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		if !tw.wroteHeader {
+			tw.code = http.StatusOK
+		}
+		w.WriteHeader(tw.code)
+		_, _ = w.Write(tw.wbuf.Bytes())
+	case <-tCtx.Done():
+		tw.mu.Lock()
+		if tw.streaming { //流式返回中客户端断开 等待控制器方法退出
+			tw.mu.Unlock()
+			<-done
+			return
+		}
+		defer tw.mu.Unlock()
+
+		tw.timedOut = true
+		if tCtx.Err() == context.DeadlineExceeded {
+			mLog.Warn("访问记录：[" + ctx.RequestId + "] timeout -- " + ctx.ClassName + "/" + ctx.MethodName)
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_, _ = io.WriteString(w, m.timeoutBody())
+		}
+	}
+}
+
+// deadlineCtx 可停止计时的超时context 流式返回开始后不再超时 客户端断开时仍会取消
+type deadlineCtx struct {
+	context.Context
+	cancel   context.CancelFunc
+	deadline time.Time
+	timer    *time.Timer
+
+	mu       sync.Mutex
+	timedOut bool
+	stopped  bool
+}
+
+func newDeadlineCtx(parent context.Context, d time.Duration) *deadlineCtx {
+	ctx, cancel := context.WithCancel(parent)
+	dc := &deadlineCtx{
+		Context:  ctx,
+		cancel:   cancel,
+		deadline: time.Now().Add(d),
+	}
+
+	dc.timer = time.AfterFunc(d, func() {
+		dc.mu.Lock()
+		fire := !dc.stopped
+		if fire {
+			dc.timedOut = true
+		}
+		dc.mu.Unlock()
+
+		if fire {
+			dc.cancel()
+		}
+	})
+
+	return dc
+}
+
+func (c *deadlineCtx) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return c.Context.Deadline()
+	}
+
+	return c.deadline, true
+}
+
+func (c *deadlineCtx) Err() error {
+	err := c.Context.Err()
+	if err == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timedOut {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
+
+// 停止超时计时 已超时则不处理
+func (c *deadlineCtx) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.timedOut {
+		c.stopped = true
+		c.timer.Stop()
+	}
+}
+
+// timeoutWriter 缓存控制器写入的数据 超时后的写入返回http.ErrHandlerTimeout
+// 调用Flush后进入流式返回 之后的数据直接写入response 并停止超时计时
+type timeoutWriter struct {
+	w    http.ResponseWriter
+	h    http.Header
+	wbuf bytes.Buffer
+
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+	code        int
+
+	streaming bool   //已进入流式返回
+	onStream  func() //进入流式返回时调用
+}
+
+// SetWriteDeadline 设置底层连接的写超时 sse等长连接通过mCtx.SetWriteDeadline取消http.Server的WriteTimeout
+func (tw *timeoutWriter) SetWriteDeadline(deadline time.Time) error {
+	return mCtx.SetWriteDeadline(tw.w, deadline)
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if tw.streaming {
+		return tw.w.Write(p)
+	}
+
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+
+	return tw.wbuf.Write(p)
+}
+
+// Hijack 接管连接 用于websocket 之后不再超时
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+
+	hj, ok := tw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("当前连接不支持Hijack")
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		tw.streaming = true
+		if tw.onStream != nil {
+			tw.onStream()
+		}
+	}
+
+	return conn, rw, err
+}
+
+// Flush 将已缓存的数据写入response并进入流式返回
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+
+	if !tw.streaming {
+		tw.streaming = true
+		if tw.onStream != nil {
+			tw.onStream()
+		}
+
+		dst := tw.w.Header()
+		for k, v := range tw.h {
+			dst[k] = v
+		}
+		if !tw.wroteHeader {
+			tw.writeHeaderLocked(http.StatusOK)
+		}
+		tw.w.WriteHeader(tw.code)
+		_, _ = tw.w.Write(tw.wbuf.Bytes())
+		tw.wbuf.Reset()
+	}
+
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.wroteHeader {
+		return
+	}
+
+	tw.wroteHeader = true
+	tw.code = code
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"github.com/solaa51/zoo/system/control"
+	"github.com/solaa51/zoo/system/mCtx"
+	"github.com/solaa51/zoo/system/router"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type slowCtl struct {
+	control.Controller
+	calls *int32
+}
+
+// 等待ms毫秒 超时或客户端断开时提前返回
+func (c *slowCtl) Sleep(ms int64) error {
+	atomic.AddInt32(c.calls, 1)
+	select {
+	case <-time.After(time.Duration(ms) * time.Millisecond):
+		return c.Ctx.Json(0, ms, "done")
+	case <-c.Ctx.Done():
+		if c.Ctx.Err() != context.DeadlineExceeded {
+			panic("unexpected error: " + c.Ctx.Err().Error())
+		}
+		return c.Ctx.Json(0, ms, "late")
+	}
+}
+
+// 先输出部分数据并Flush 之后不再受超时限制
+func (c *slowCtl) Stream(ms int64) {
+	_, _ = io.WriteString(c.Ctx.ResponseWriter, "a")
+	c.Ctx.ResponseWriter.(http.Flusher).Flush()
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	_, _ = io.WriteString(c.Ctx.ResponseWriter, "b")
+}
+
+// sse推送 每隔ms毫秒发送一次 共3次
+func (c *slowCtl) Events(ms int64) error {
+	sse, err := c.Ctx.SSE()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		if err = sse.Data("e" + strconv.Itoa(i)); err != nil {
+			return err
+		}
+	}
+
+	return mCtx.ErrResponded
+}
+
+func newSlowHandle(calls *int32) *MHandle {
+	h := New()
+	h.SetRouter(router.New())
+	h.SetRpcPath("/rpc")
+	h.AddCompile("slow", func() control.Control { return &slowCtl{calls: calls} })
+	h.SetTimeout(50 * time.Millisecond)
+
+	return h
+}
+
+func TestTimeout(t *testing.T) {
+	var calls int32
+	h := newSlowHandle(&calls)
+
+	if w := serveGet(h, "/slow/sleep/0"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"msg":"done"`) {
+		t.Errorf("fast: status = %d body = %s", w.Code, w.Body.String())
+	}
+
+	if w := serveGet(h, "/slow/sleep/300"); w.Code != http.StatusGatewayTimeout || w.Body.String() != "Timeout" {
+		t.Errorf("slow: status = %d body = %s", w.Code, w.Body.String())
+	}
+
+	h.SetTimeoutBody("busy")
+	if w := serveGet(h, "/slow/sleep/300"); w.Code != http.StatusGatewayTimeout || w.Body.String() != "busy" {
+		t.Errorf("timeout body: status = %d body = %s", w.Code, w.Body.String())
+	}
+
+	//流式返回开始后停止超时计时
+	if w := serveGet(h, "/slow/stream/100"); w.Code != http.StatusOK || w.Body.String() != "ab" {
+		t.Errorf("stream: status = %d body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	var calls int32
+	h := newSlowHandle(&calls)
+	h.SetRouteTimeout("slow", "", 200*time.Millisecond)
+	h.SetRouteTimeout("slow", "stream", 10*time.Millisecond)
+
+	//class的超时时间优先于全局
+	if w := serveGet(h, "/slow/sleep/100"); w.Code != http.StatusOK {
+		t.Errorf("class timeout: status = %d", w.Code)
+	}
+
+	//method的超时时间优先于class 流式返回前超时
+	h.SetRouteTimeout("slow", "sleep", 10*time.Millisecond)
+	if w := serveGet(h, "/slow/sleep/100"); w.Code != http.StatusGatewayTimeout {
+		t.Errorf("method timeout: status = %d", w.Code)
+	}
+
+	//小于等于0不限制
+	h.SetRouteTimeout("slow", "sleep", 0)
+	if w := serveGet(h, "/slow/sleep/100"); w.Code != http.StatusOK {
+		t.Errorf("no timeout: status = %d", w.Code)
+	}
+}
+
+func TestRpcBatchTimeout(t *testing.T) {
+	var calls int32
+	h := newSlowHandle(&calls)
+	h.SetTimeout(100 * time.Millisecond)
+	h.SetTimeoutBody("busy")
+	h.SetRouteTimeout("slow", "sleep", time.Second) //单次调用的超时时间不累加
+
+	start := time.Now()
+	w := rpcPost(h, `[
+		{"jsonrpc":"2.0","method":"slow.sleep","params":[60],"id":1},
+		{"jsonrpc":"2.0","method":"slow.sleep","params":[60],"id":2},
+		{"jsonrpc":"2.0","method":"slow.sleep","params":[60],"id":3}
+	]`)
+
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Errorf("batch took %s", d)
+	}
+
+	want := `[{"jsonrpc":"2.0","result":{"msg":"done","ret":0,"data":60},"id":1},` +
+		`{"jsonrpc":"2.0","error":{"code":-32000,"message":"busy"},"id":2},` +
+		`{"jsonrpc":"2.0","error":{"code":-32000,"message":"busy"},"id":3}]`
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %s\nwant   %s", got, want)
+	}
+
+	//超时后的调用不再执行
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
+
+// sse经过timeoutWriter 同时不受handler超时与http.Server的WriteTimeout限制 http/2同样有效
+func TestSSETimeout(t *testing.T) {
+	var calls int32
+	h := newSlowHandle(&calls)
+
+	for _, http2 := range []bool{false, true} {
+		ts := httptest.NewUnstartedServer(h)
+		ts.Config.WriteTimeout = 100 * time.Millisecond
+		ts.Config.ConnContext = mCtx.WithConn
+		if http2 {
+			ts.EnableHTTP2 = true
+			ts.StartTLS()
+		} else {
+			ts.Start()
+		}
+
+		resp, err := ts.Client().Get(ts.URL + "/slow/events/60")
+		if err != nil {
+			ts.Close()
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		ts.Close()
+
+		if want := "data: e0\n\ndata: e1\n\ndata: e2\n\n"; err != nil || string(b) != want {
+			t.Errorf("%s: err = %v body = %q", resp.Proto, err, b)
+		}
+	}
+}
@@ -1,8 +1,8 @@
 package fileMonitor
 
 import (
-	"bufio"
 	"github.com/solaa51/zoo/system/mLog"
+	"io"
 	"os"
 	"sync"
 	"time"
@@ -35,31 +35,35 @@ func New(fullFileName string, pf func(interface{})) {
 }
 
 //监控文件状态 变化时 执行预设函数
+//文件替换过程中可能短暂不存在 此时跳过 下次再检查
 func (c *confModify) listenModify(pf func(interface{})) {
 	c.m.Lock()
+	defer c.m.Unlock()
+
 	file, err := os.Open(c.path)
 	if err != nil {
-		mLog.Fatal("获取文件出错")
+		mLog.Error("获取文件出错：" + c.path + " " + err.Error())
+		return
 	}
 
 	defer file.Close()
 
 	fileInfo, err := file.Stat()
 	if err != nil {
-		mLog.Fatal("获取文件基本信息出错")
+		mLog.Error("获取文件基本信息出错：" + c.path + " " + err.Error())
+		return
 	}
 
 	if fileInfo.ModTime().Unix() != c.modTime {
-		c.modTime = fileInfo.ModTime().Unix()
-
 		//调用参数 看情况 传递 本处为返回文件内容
 		//如果文件内容大 则最好 在自定义函数中自己处理
-		fr := bufio.NewReader(file)
 		b2 := make([]byte, fileInfo.Size())
-		_, _ = fr.Read(b2)
+		if _, err = io.ReadFull(file, b2); err != nil {
+			mLog.Error("读取文件出错：" + c.path + " " + err.Error())
+			return
+		}
+		c.modTime = fileInfo.ModTime().Unix()
 		c.content = b2
 		pf(string(b2)) //调用函数
 	}
-
-	c.m.Unlock()
 }
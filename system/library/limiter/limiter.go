@@ -0,0 +1,366 @@
+package limiter
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+限流器
+	令牌桶 TokenBucket 按固定速率生成令牌 允许一定的突发流量
+	滑动窗口 SlidingWindow 窗口时间内最多允许limit次请求
+每种算法按key独立计数 key可为客户端IP、app_key、class/method等
+*/
+
+// Limiter 限流算法接口
+type Limiter interface {
+	// Allow 判断key是否允许通过 不允许时返回建议的等待时间
+	Allow(key string) (bool, time.Duration)
+}
+
+// Refunder 可退回一次已通过的计数 组内后续规则拒绝请求时使用
+type Refunder interface {
+	Refund(key string)
+}
+
+// 清理长时间未访问的key的间隔
+const cleanInterval = time.Minute
+
+// TokenBucket 令牌桶
+type TokenBucket struct {
+	mu      sync.Mutex
+	rate    float64 //每秒生成的令牌数
+	burst   float64 //桶的容量
+	buckets map[string]*bucket
+	cleaned time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket 创建令牌桶 rate每秒生成的令牌数 burst桶的容量 小于1时按1处理
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &TokenBucket{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket, 0),
+		cleaned: time.Now(),
+	}
+}
+
+// Allow 取出一个令牌 没有令牌时返回下一个令牌生成的等待时间
+func (t *TokenBucket) Allow(key string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.clean(now)
+
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &bucket{tokens: t.burst, last: now}
+		t.buckets[key] = b
+	}
+
+	//补充令牌
+	b.tokens = math.Min(t.burst, b.tokens+now.Sub(b.last).Seconds()*t.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if t.rate <= 0 {
+		return false, cleanInterval
+	}
+
+	return false, time.Duration((1 - b.tokens) / t.rate * float64(time.Second))
+}
+
+// Refund 退回一个令牌 不超过桶的容量
+func (t *TokenBucket) Refund(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if b, ok := t.buckets[key]; ok {
+		b.tokens = math.Min(t.burst, b.tokens+1)
+	}
+}
+
+// 清理已补满令牌的key 等同于从未访问
+func (t *TokenBucket) clean(now time.Time) {
+	if now.Sub(t.cleaned) < cleanInterval {
+		return
+	}
+	t.cleaned = now
+
+	for k, b := range t.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*t.rate >= t.burst {
+			delete(t.buckets, k)
+		}
+	}
+}
+
+// SlidingWindow 滑动窗口
+// 按上一个窗口的计数加权估算 不需要记录每次请求的时间
+type SlidingWindow struct {
+	mu      sync.Mutex
+	limit   float64       //窗口内允许的次数
+	window  time.Duration //窗口时长
+	windows map[string]*window
+	cleaned time.Time
+}
+
+type window struct {
+	start time.Time //当前窗口开始时间
+	prev  float64   //上一个窗口的计数
+	curr  float64   //当前窗口的计数
+}
+
+// NewSlidingWindow 创建滑动窗口 d时间内最多允许limit次
+func NewSlidingWindow(limit int, d time.Duration) *SlidingWindow {
+	if d <= 0 {
+		d = time.Second
+	}
+
+	return &SlidingWindow{
+		limit:   float64(limit),
+		window:  d,
+		windows: make(map[string]*window, 0),
+		cleaned: time.Now(),
+	}
+}
+
+// Allow 计数加一 超出限制时返回估算的等待时间
+func (s *SlidingWindow) Allow(key string) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.clean(now)
+
+	w, ok := s.windows[key]
+	if !ok {
+		w = &window{start: now}
+		s.windows[key] = w
+	}
+
+	//滚动窗口
+	if elapsed := now.Sub(w.start); elapsed >= s.window {
+		if elapsed < 2*s.window {
+			w.prev = w.curr
+		} else {
+			w.prev = 0
+		}
+		w.curr = 0
+		w.start = w.start.Add(elapsed / s.window * s.window)
+	}
+
+	elapsed := now.Sub(w.start)
+	weight := 1 - float64(elapsed)/float64(s.window)
+	if w.prev*weight+w.curr+1 <= s.limit {
+		w.curr++
+		return true, 0
+	}
+
+	//当前窗口已用完 等待进入下一个窗口
+	if w.curr+1 > s.limit || w.prev == 0 {
+		return false, s.window - elapsed
+	}
+
+	//等待上一个窗口的权重衰减到允许通过
+	need := (w.prev*weight + w.curr + 1 - s.limit) / w.prev
+	return false, time.Duration(need * float64(s.window))
+}
+
+// Refund 当前窗口的计数减一
+func (s *SlidingWindow) Refund(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if w, ok := s.windows[key]; ok && w.curr > 0 {
+		w.curr--
+	}
+}
+
+// 清理两个窗口内未访问的key
+func (s *SlidingWindow) clean(now time.Time) {
+	if now.Sub(s.cleaned) < cleanInterval {
+		return
+	}
+	s.cleaned = now
+
+	for k, w := range s.windows {
+		if now.Sub(w.start) >= 2*s.window {
+			delete(s.windows, k)
+		}
+	}
+}
+
+// 规则的key类型
+const (
+	KeyIp     = "ip"      //按客户端IP限流
+	KeyAppKey = "app_key" //按签名验证通过的app_key限流
+	KeyRoute  = "route"   //按class/method限流
+)
+
+// 算法类型
+const (
+	AlgorithmToken  = "token"  //令牌桶
+	AlgorithmWindow = "window" //滑动窗口
+)
+
+// Rule 限流规则 可在app.toml中通过[[limiter]]配置
+type Rule struct {
+	Key       string `toml:"key"`       //ip app_key route
+	Algorithm string `toml:"algorithm"` //token window 默认token
+	Rate      int    `toml:"rate"`      //令牌桶 每秒生成的令牌数 更低的频率可使用滑动窗口
+	Burst     int    `toml:"burst"`     //令牌桶 桶的容量
+	Limit     int    `toml:"limit"`     //滑动窗口 窗口内允许的次数
+	Window    int64  `toml:"window"`    //滑动窗口 窗口时长 单位秒
+	Class     string `toml:"class"`     //仅作用于指定的class 为空则作用于全部
+	Method    string `toml:"method"`    //仅作用于指定的method 需同时指定class
+}
+
+// Check 检查规则配置是否正确
+func (r Rule) Check() error {
+	switch r.Key {
+	case KeyIp, KeyAppKey, KeyRoute:
+	default:
+		return errors.New("limiter不支持的key:" + r.Key)
+	}
+
+	if r.Method != "" && r.Class == "" {
+		return errors.New("limiter指定method时需同时指定class")
+	}
+
+	switch r.Algorithm {
+	case "", AlgorithmToken:
+		if r.Rate <= 0 {
+			return errors.New("limiter令牌桶rate必须大于0")
+		}
+	case AlgorithmWindow:
+		if r.Limit <= 0 || r.Window <= 0 {
+			return errors.New("limiter滑动窗口limit window必须大于0")
+		}
+	default:
+		return errors.New("limiter不支持的算法:" + r.Algorithm)
+	}
+
+	return nil
+}
+
+// 规则与对应的限流器
+type rule struct {
+	Rule
+	limiter Limiter
+}
+
+// Group 一组限流规则 请求需通过全部规则
+type Group struct {
+	rules []*rule
+}
+
+// NewGroup 根据规则创建限流器组
+func NewGroup(rules []Rule) (*Group, error) {
+	g := &Group{
+		rules: make([]*rule, 0, len(rules)),
+	}
+
+	for _, v := range rules {
+		if err := v.Check(); err != nil {
+			return nil, err
+		}
+
+		var l Limiter
+		if v.Algorithm == AlgorithmWindow {
+			l = NewSlidingWindow(v.Limit, time.Duration(v.Window)*time.Second)
+		} else {
+			l = NewTokenBucket(float64(v.Rate), v.Burst)
+		}
+
+		g.rules = append(g.rules, &rule{Rule: v, limiter: l})
+	}
+
+	return g, nil
+}
+
+// Allow 检查请求是否允许通过 包含全部key类型的规则
+// ip appKey为请求的客户端IP和app_key 为空的key类型不参与限流
+func (g *Group) Allow(className string, methodName string, ip string, appKey string) (bool, time.Duration) {
+	return g.allow(className, methodName, map[string]string{
+		KeyIp:     ip,
+		KeyAppKey: appKey,
+		KeyRoute:  className + "/" + methodName,
+	})
+}
+
+// AllowRequest 检查ip与route规则 在解析请求数据和验证签名之前调用
+func (g *Group) AllowRequest(className string, methodName string, ip string) (bool, time.Duration) {
+	return g.allow(className, methodName, map[string]string{
+		KeyIp:    ip,
+		KeyRoute: className + "/" + methodName,
+	})
+}
+
+// AllowAppKey 检查app_key规则 在签名验证通过之后调用
+func (g *Group) AllowAppKey(className string, methodName string, appKey string) (bool, time.Duration) {
+	return g.allow(className, methodName, map[string]string{
+		KeyAppKey: appKey,
+	})
+}
+
+// 按key类型检查规则 未包含或为空的key类型不参与限流
+// 某条规则拒绝时 退回之前规则已通过的计数 被拒绝的请求不占用其他规则的额度
+func (g *Group) allow(className string, methodName string, keys map[string]string) (bool, time.Duration) {
+	type taken struct {
+		limiter Limiter
+		key     string
+	}
+	passed := make([]taken, 0, len(g.rules))
+
+	for _, v := range g.rules {
+		if v.Class != "" && v.Class != className {
+			continue
+		}
+		if v.Method != "" && !equalMethod(v.Method, methodName) {
+			continue
+		}
+
+		key := keys[v.Key]
+		if key == "" {
+			continue
+		}
+
+		if ok, wait := v.limiter.Allow(key); !ok {
+			for _, t := range passed {
+				if r, ok := t.limiter.(Refunder); ok {
+					r.Refund(t.key)
+				}
+			}
+			return false, wait
+		}
+		passed = append(passed, taken{limiter: v.limiter, key: key})
+	}
+
+	return true, 0
+}
+
+// method名首字母不区分大小写 与路由解析结果一致
+func equalMethod(a string, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+
+	return strings.ToUpper(a[:1])+a[1:] == strings.ToUpper(b[:1])+b[1:]
+}
@@ -0,0 +1,165 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	l := NewTokenBucket(10, 2)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("burst %d rejected", i)
+		}
+	}
+
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("empty bucket allowed")
+	}
+	if wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("wait = %s", wait)
+	}
+
+	//key之间独立计数
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("other key rejected")
+	}
+
+	time.Sleep(wait + 10*time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("refilled token rejected")
+	}
+}
+
+func TestTokenBucketRefund(t *testing.T) {
+	l := NewTokenBucket(1, 1)
+
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first rejected")
+	}
+	l.Refund("a")
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("refunded token rejected")
+	}
+
+	//退回不超过桶的容量
+	l.Refund("a")
+	l.Refund("a")
+	l.Allow("a")
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("refund exceeded burst")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	l := NewSlidingWindow(3, 100*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d rejected", i)
+		}
+	}
+
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("over limit allowed")
+	}
+	if wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("wait = %s", wait)
+	}
+
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("other key rejected")
+	}
+
+	l.Refund("a")
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("refunded request rejected")
+	}
+
+	//两个窗口之后不再受之前的计数影响
+	time.Sleep(210 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d after windows rejected", i)
+		}
+	}
+}
+
+func TestRuleCheck(t *testing.T) {
+	cases := []struct {
+		rule Rule
+		ok   bool
+	}{
+		{Rule{Key: KeyIp, Rate: 1}, true},
+		{Rule{Key: KeyAppKey, Algorithm: AlgorithmToken, Rate: 1, Burst: 5}, true},
+		{Rule{Key: KeyRoute, Algorithm: AlgorithmWindow, Limit: 10, Window: 60}, true},
+		{Rule{Key: KeyIp, Rate: 1, Class: "user", Method: "info"}, true},
+		{Rule{Key: "uid", Rate: 1}, false},
+		{Rule{Key: KeyIp, Rate: 0}, false},
+		{Rule{Key: KeyIp, Algorithm: AlgorithmWindow, Limit: 10}, false},
+		{Rule{Key: KeyIp, Algorithm: "leaky", Rate: 1}, false},
+		{Rule{Key: KeyIp, Rate: 1, Method: "info"}, false},
+	}
+
+	for _, v := range cases {
+		if err := v.rule.Check(); (err == nil) != v.ok {
+			t.Errorf("Check(%+v) = %v", v.rule, err)
+		}
+	}
+
+	if _, err := NewGroup([]Rule{{Key: KeyIp, Rate: 1}, {Key: "uid", Rate: 1}}); err == nil {
+		t.Error("NewGroup accepted an invalid rule")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	g, err := NewGroup([]Rule{
+		{Key: KeyIp, Rate: 1, Burst: 3},
+		{Key: KeyRoute, Rate: 1, Burst: 1, Class: "user", Method: "login"},
+		{Key: KeyAppKey, Algorithm: AlgorithmWindow, Limit: 1, Window: 60},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//route规则只作用于指定的class method method首字母不区分大小写
+	if ok, _ := g.AllowRequest("user", "Login", "1.1.1.1"); !ok {
+		t.Fatal("first login rejected")
+	}
+	ok, wait := g.AllowRequest("user", "Login", "1.1.1.1")
+	if ok || wait <= 0 {
+		t.Fatalf("second login = %v %s", ok, wait)
+	}
+
+	//被route规则拒绝时退回ip规则的计数 ip仍剩余2次
+	for i := 0; i < 2; i++ {
+		if ok, _ := g.AllowRequest("user", "info", "1.1.1.1"); !ok {
+			t.Fatalf("info %d rejected", i)
+		}
+	}
+	if ok, _ := g.AllowRequest("user", "info", "1.1.1.1"); ok {
+		t.Error("ip limit not applied")
+	}
+
+	//app_key规则只在AllowAppKey中检查 为空时不参与限流
+	if ok, _ := g.AllowAppKey("user", "info", ""); !ok {
+		t.Error("empty app_key rejected")
+	}
+	if ok, _ := g.AllowAppKey("user", "info", "k1"); !ok {
+		t.Error("first app_key rejected")
+	}
+	if ok, _ := g.AllowAppKey("user", "info", "k1"); ok {
+		t.Error("app_key limit not applied")
+	}
+
+	//Allow包含全部key类型
+	if ok, _ := g.Allow("order", "list", "2.2.2.2", "k1"); ok {
+		t.Error("Allow ignored app_key rule")
+	}
+	if ok, _ := g.Allow("order", "list", "2.2.2.2", "k2"); !ok {
+		t.Error("Allow rejected a fresh request")
+	}
+}
@@ -0,0 +1,128 @@
+package nonce
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+/**
+nonce存储 用于签名请求的防重放
+默认提供有容量上限的内存存储
+多实例部署时可实现Store接口 使用redis等共享存储
+*/
+
+// Store nonce存储接口
+type Store interface {
+	// Check 记录nonce 有效期内已存在或无法记录时返回false
+	Check(nonce string, expire time.Duration) bool
+}
+
+// 单条记录
+type item struct {
+	nonce  string
+	expire time.Time
+}
+
+// Memory 内存存储 容量已满且没有过期的记录时拒绝新的nonce
+// 淘汰未过期的记录会使对应的请求可以被重放 因此不淘汰
+type Memory struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List //按写入顺序排列
+}
+
+// 默认最多保留的nonce数量
+const defaultSize = 100000
+
+// NewMemory 创建内存存储 size为最多保留的nonce数量
+func NewMemory(size int) *Memory {
+	if size <= 0 {
+		size = defaultSize
+	}
+
+	return &Memory{
+		size:  size,
+		items: make(map[string]*list.Element, 0),
+		order: list.New(),
+	}
+}
+
+// Check 记录nonce 有效期内已存在或容量已满时返回false
+func (m *Memory) Check(nonce string, expire time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := m.items[nonce]; ok {
+		if e.Value.(*item).expire.After(now) {
+			return false
+		}
+		m.remove(e)
+	}
+
+	//清理已过期的记录
+	for e := m.order.Front(); e != nil; e = m.order.Front() {
+		if e.Value.(*item).expire.After(now) {
+			break
+		}
+		m.remove(e)
+	}
+
+	//容量已满时 清理全部已过期的记录 有效期不同时过期的记录可能不在队首
+	if m.order.Len() >= m.size {
+		for e := m.order.Front(); e != nil; {
+			next := e.Next()
+			if !e.Value.(*item).expire.After(now) {
+				m.remove(e)
+			}
+			e = next
+		}
+	}
+
+	//容量已满 拒绝新的请求
+	if m.order.Len() >= m.size {
+		return false
+	}
+
+	m.items[nonce] = m.order.PushBack(&item{
+		nonce:  nonce,
+		expire: now.Add(expire),
+	})
+
+	return true
+}
+
+// Full 容量是否已满 已满时Check拒绝新的nonce
+func (m *Memory) Full() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.order.Len() >= m.size
+}
+
+// Resize 修改容量 已记录的nonce全部保留 直到过期
+func (m *Memory) Resize(size int) {
+	if size <= 0 {
+		size = defaultSize
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.size = size
+}
+
+// Len 当前保留的nonce数量
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.order.Len()
+}
+
+func (m *Memory) remove(e *list.Element) {
+	m.order.Remove(e)
+	delete(m.items, e.Value.(*item).nonce)
+}
@@ -0,0 +1,77 @@
+package nonce
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryCheck(t *testing.T) {
+	m := NewMemory(10)
+
+	if !m.Check("a", time.Minute) {
+		t.Fatal("first nonce rejected")
+	}
+	if m.Check("a", time.Minute) {
+		t.Error("reused nonce accepted")
+	}
+	if !m.Check("b", time.Minute) {
+		t.Error("another nonce rejected")
+	}
+
+	//过期后可再次使用
+	if !m.Check("c", time.Millisecond) {
+		t.Fatal("nonce rejected")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if !m.Check("c", time.Minute) {
+		t.Error("expired nonce rejected")
+	}
+}
+
+func TestMemoryFull(t *testing.T) {
+	m := NewMemory(2)
+	m.Check("a", time.Minute)
+	m.Check("b", time.Millisecond)
+
+	if !m.Full() {
+		t.Fatal("store not full")
+	}
+
+	//已过期的记录被清理后可写入
+	time.Sleep(5 * time.Millisecond)
+	if !m.Check("c", time.Minute) {
+		t.Fatal("nonce rejected after expire")
+	}
+
+	//容量已满时拒绝 且不淘汰未过期的记录
+	if m.Check("d", time.Minute) {
+		t.Error("nonce accepted when full")
+	}
+	if m.Check("a", time.Minute) {
+		t.Error("unexpired nonce evicted")
+	}
+	if m.Len() != 2 {
+		t.Errorf("len = %d, want 2", m.Len())
+	}
+
+	//扩容后可写入 已记录的保留
+	m.Resize(3)
+	if m.Full() || !m.Check("d", time.Minute) {
+		t.Error("nonce rejected after resize")
+	}
+	if m.Check("a", time.Minute) {
+		t.Error("nonce lost after resize")
+	}
+
+	//缩容后 已记录的保留到过期
+	m.Resize(1)
+	if m.Len() != 3 || !m.Full() {
+		t.Errorf("len = %d full = %v after shrink", m.Len(), m.Full())
+	}
+}
+
+func TestNewMemoryDefault(t *testing.T) {
+	if m := NewMemory(0); m.size != defaultSize {
+		t.Errorf("size = %d, want %d", m.size, defaultSize)
+	}
+}
@@ -0,0 +1,532 @@
+package wsHub
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/solaa51/zoo/system/mLog"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+websocket连接管理
+	连接注册 房间 主题订阅 广播 ping/pong保活 每个连接独立的写goroutine 平滑关闭
+
+	var hub = wsHub.New(wsHub.Options{})
+
+	func (w *Welcome) Ws() error {
+		ws, err := w.Ctx.WebSocket()
+		if err != nil {
+			return err
+		}
+		c := hub.Register(ws, w.Ctx.RequestId)
+		c.Join("lobby")
+		return nil //连接由hub管理 控制器方法直接返回
+	}
+
+	hub.OnMessage(func(c *wsHub.Conn, msgType int, data []byte) { ... })
+	hub.BroadcastRoom("lobby", []byte("hello"))
+	hub.Publish("order.paid", data) //订阅了 order.paid order.* * 的连接均可收到
+*/
+
+var (
+	ErrClosed = errors.New("连接已关闭")
+	ErrSlow   = errors.New("发送缓冲已满 连接已关闭")
+)
+
+// Options hub配置 为0时使用默认值
+type Options struct {
+	WriteWait      time.Duration //单次写入超时 默认10秒
+	PongWait       time.Duration //等待pong的时间 超时视为断开 默认60秒
+	PingPeriod     time.Duration //发送ping的间隔 必须小于PongWait 默认为PongWait的9/10
+	MaxMessageSize int64         //读取消息的最大字节数 默认64KB
+	SendBuffer     int           //每个连接的发送缓冲 满了视为慢连接并关闭 默认256
+}
+
+func (o *Options) init() {
+	if o.WriteWait <= 0 {
+		o.WriteWait = 10 * time.Second
+	}
+	if o.PongWait <= 0 {
+		o.PongWait = 60 * time.Second
+	}
+	if o.PingPeriod <= 0 || o.PingPeriod >= o.PongWait {
+		o.PingPeriod = o.PongWait * 9 / 10
+	}
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = 64 << 10
+	}
+	if o.SendBuffer <= 0 {
+		o.SendBuffer = 256
+	}
+}
+
+// Hub websocket连接管理
+type Hub struct {
+	opts Options
+
+	mu      sync.RWMutex
+	conns   map[*Conn]struct{}
+	ids     map[string]*Conn
+	rooms   map[string]map[*Conn]struct{}
+	topics  map[string]map[*Conn]struct{}
+	closing bool
+
+	onMessage func(c *Conn, msgType int, data []byte)
+	onClose   func(c *Conn)
+
+	wg sync.WaitGroup
+}
+
+// New 创建hub
+func New(opts Options) *Hub {
+	opts.init()
+
+	return &Hub{
+		opts:   opts,
+		conns:  make(map[*Conn]struct{}),
+		ids:    make(map[string]*Conn),
+		rooms:  make(map[string]map[*Conn]struct{}),
+		topics: make(map[string]map[*Conn]struct{}),
+	}
+}
+
+// OnMessage 设置收到消息时的回调 在连接的读goroutine中调用
+// 回调panic时记录日志 以1011关闭该连接
+func (h *Hub) OnMessage(f func(c *Conn, msgType int, data []byte)) {
+	h.mu.Lock()
+	h.onMessage = f
+	h.mu.Unlock()
+}
+
+// OnClose 设置连接关闭时的回调
+func (h *Hub) OnClose(f func(c *Conn)) {
+	h.mu.Lock()
+	h.onClose = f
+	h.mu.Unlock()
+}
+
+// Register 注册连接并启动读写goroutine id相同的旧连接会被关闭
+func (h *Hub) Register(ws *websocket.Conn, id string) *Conn {
+	c := &Conn{
+		Id:        id,
+		hub:       h,
+		ws:        ws,
+		send:      make(chan message, h.opts.SendBuffer),
+		done:      make(chan struct{}),
+		closeCode: websocket.CloseNormalClosure,
+		rooms:     make(map[string]struct{}),
+		topics:    make(map[string]struct{}),
+	}
+
+	h.mu.Lock()
+	if h.closing {
+		h.mu.Unlock()
+		_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(h.opts.WriteWait))
+		_ = ws.Close()
+		close(c.done)
+		return c
+	}
+
+	old := h.ids[id]
+	h.conns[c] = struct{}{}
+	if id != "" {
+		h.ids[id] = c
+	}
+	h.wg.Add(2)
+	h.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	go c.writePump()
+	go c.readPump()
+
+	return c
+}
+
+// Get 按id获取连接
+func (h *Hub) Get(id string) *Conn {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.ids[id]
+}
+
+// Count 当前连接数
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.conns)
+}
+
+// RoomCount 房间内的连接数
+func (h *Hub) RoomCount(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.rooms[room])
+}
+
+// Broadcast 向全部连接发送文本消息
+func (h *Hub) Broadcast(data []byte) {
+	h.mu.RLock()
+	list := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		list = append(list, c)
+	}
+	h.mu.RUnlock()
+
+	sendAll(list, websocket.TextMessage, data)
+}
+
+// BroadcastRoom 向房间内的连接发送文本消息
+func (h *Hub) BroadcastRoom(room string, data []byte) {
+	h.mu.RLock()
+	list := make([]*Conn, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		list = append(list, c)
+	}
+	h.mu.RUnlock()
+
+	sendAll(list, websocket.TextMessage, data)
+}
+
+// Publish 向订阅了主题的连接发送文本消息
+// 订阅 a.b.* 可收到 a.b.c 订阅 * 可收到全部主题
+func (h *Hub) Publish(topic string, data []byte) {
+	h.mu.RLock()
+	set := make(map[*Conn]struct{})
+	for pattern, conns := range h.topics {
+		if !topicMatch(pattern, topic) {
+			continue
+		}
+		for c := range conns {
+			set[c] = struct{}{}
+		}
+	}
+	h.mu.RUnlock()
+
+	list := make([]*Conn, 0, len(set))
+	for c := range set {
+		list = append(list, c)
+	}
+
+	sendAll(list, websocket.TextMessage, data)
+}
+
+func topicMatch(pattern string, topic string) bool {
+	if pattern == "*" || pattern == topic {
+		return true
+	}
+
+	return strings.HasSuffix(pattern, ".*") && strings.HasPrefix(topic, pattern[:len(pattern)-1])
+}
+
+func sendAll(list []*Conn, msgType int, data []byte) {
+	for _, c := range list {
+		_ = c.SendMessage(msgType, data)
+	}
+}
+
+// Shutdown 向全部连接发送关闭帧并等待连接退出 之后注册的连接会被直接关闭
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closing = true
+	list := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		list = append(list, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range list {
+		c.closeWith(websocket.CloseGoingAway)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, c := range list { //超时后强制关闭
+			_ = c.ws.Close()
+		}
+		return ctx.Err()
+	}
+}
+
+// 移除连接 并退出全部房间与主题
+func (h *Hub) remove(c *Conn) {
+	h.mu.Lock()
+	if _, ok := h.conns[c]; !ok {
+		h.mu.Unlock()
+		return
+	}
+
+	delete(h.conns, c)
+	if h.ids[c.Id] == c {
+		delete(h.ids, c.Id)
+	}
+	for room := range c.rooms {
+		leave(h.rooms, room, c)
+	}
+	for topic := range c.topics {
+		leave(h.topics, topic, c)
+	}
+	onClose := h.onClose
+	h.mu.Unlock()
+
+	if onClose != nil {
+		onClose(c)
+	}
+}
+
+func join(m map[string]map[*Conn]struct{}, key string, c *Conn) {
+	if m[key] == nil {
+		m[key] = make(map[*Conn]struct{})
+	}
+	m[key][c] = struct{}{}
+}
+
+func leave(m map[string]map[*Conn]struct{}, key string, c *Conn) {
+	delete(m[key], c)
+	if len(m[key]) == 0 {
+		delete(m, key)
+	}
+}
+
+type message struct {
+	msgType int
+	data    []byte
+}
+
+// Conn hub管理的单个连接
+type Conn struct {
+	Id  string
+	hub *Hub
+	ws  *websocket.Conn
+
+	send      chan message
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+
+	rooms  map[string]struct{} //由hub.mu保护
+	topics map[string]struct{} //由hub.mu保护
+
+	values sync.Map //连接上保存的自定义数据
+}
+
+// Set 保存自定义数据 如登录的用户信息
+func (c *Conn) Set(key string, value interface{}) {
+	c.values.Store(key, value)
+}
+
+// Get 获取自定义数据
+func (c *Conn) Get(key string) (interface{}, bool) {
+	return c.values.Load(key)
+}
+
+// Done 连接关闭时关闭
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Send 发送文本消息
+func (c *Conn) Send(data []byte) error {
+	return c.SendMessage(websocket.TextMessage, data)
+}
+
+// SendJson 发送json消息
+func (c *Conn) SendJson(v interface{}) error {
+	b, err := jsoniter.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.SendMessage(websocket.TextMessage, b)
+}
+
+// SendMessage 放入发送缓冲 由写goroutine发送 缓冲已满时关闭连接
+func (c *Conn) SendMessage(msgType int, data []byte) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case c.send <- message{msgType: msgType, data: data}:
+		return nil
+	default:
+		c.closeWith(websocket.ClosePolicyViolation)
+		return ErrSlow
+	}
+}
+
+// Join 加入房间
+func (c *Conn) Join(rooms ...string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	if _, ok := c.hub.conns[c]; !ok {
+		return
+	}
+	for _, room := range rooms {
+		c.rooms[room] = struct{}{}
+		join(c.hub.rooms, room, c)
+	}
+}
+
+// Leave 离开房间
+func (c *Conn) Leave(rooms ...string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	for _, room := range rooms {
+		if _, ok := c.rooms[room]; ok {
+			delete(c.rooms, room)
+			leave(c.hub.rooms, room, c)
+		}
+	}
+}
+
+// Subscribe 订阅主题 支持 a.b.* 与 *
+func (c *Conn) Subscribe(topics ...string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	if _, ok := c.hub.conns[c]; !ok {
+		return
+	}
+	for _, topic := range topics {
+		c.topics[topic] = struct{}{}
+		join(c.hub.topics, topic, c)
+	}
+}
+
+// Unsubscribe 取消订阅主题
+func (c *Conn) Unsubscribe(topics ...string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	for _, topic := range topics {
+		if _, ok := c.topics[topic]; ok {
+			delete(c.topics, topic)
+			leave(c.hub.topics, topic, c)
+		}
+	}
+}
+
+// Close 关闭连接 发送缓冲中的消息会先发送完
+func (c *Conn) Close() {
+	c.closeWith(websocket.CloseNormalClosure)
+}
+
+func (c *Conn) closeWith(code int) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		close(c.done)
+		c.hub.remove(c)
+	})
+}
+
+// 读取消息 并处理pong
+func (c *Conn) readPump() {
+	defer c.hub.wg.Done()
+	defer c.Close()
+
+	opts := c.hub.opts
+	c.ws.SetReadLimit(opts.MaxMessageSize)
+	_ = c.ws.SetReadDeadline(time.Now().Add(opts.PongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(opts.PongWait))
+	})
+
+	for {
+		msgType, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		c.hub.mu.RLock()
+		onMessage := c.hub.onMessage
+		c.hub.mu.RUnlock()
+		if onMessage != nil && !c.handle(onMessage, msgType, data) {
+			return
+		}
+	}
+}
+
+// 调用消息回调 panic时记录日志并只关闭当前连接 其他连接不受影响
+func (c *Conn) handle(onMessage func(c *Conn, msgType int, data []byte), msgType int, data []byte) (ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			var buf [4096]byte
+			n := runtime.Stack(buf[:], false)
+			mLog.Error("websocket消息处理异常：["+c.Id+"]", e, string(buf[:n]))
+			c.closeWith(websocket.CloseInternalServerErr)
+			ok = false
+		}
+	}()
+
+	onMessage(c, msgType, data)
+	return true
+}
+
+// 发送消息与ping 连接上唯一的写入者
+func (c *Conn) writePump() {
+	defer c.hub.wg.Done()
+
+	opts := c.hub.opts
+	ticker := time.NewTicker(opts.PingPeriod)
+	defer func() {
+		ticker.Stop()
+		_ = c.ws.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if err := c.ws.WriteMessage(msg.msgType, msg.data); err != nil {
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.done:
+			//发送缓冲中剩余的消息后发送关闭帧
+			deadline := time.Now().Add(opts.WriteWait)
+			_ = c.ws.SetWriteDeadline(deadline)
+		drain:
+			for {
+				select {
+				case msg := <-c.send:
+					if err := c.ws.WriteMessage(msg.msgType, msg.data); err != nil {
+						return
+					}
+				default:
+					break drain
+				}
+			}
+			_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, ""), deadline)
+			return
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package wsHub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 启动websocket服务 连接以url参数id注册 room与topic参数加入房间和订阅主题
+func hubServer(t *testing.T, h *Hub) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := h.Register(ws, r.URL.Query().Get("id"))
+		if room := r.URL.Query().Get("room"); room != "" {
+			c.Join(room)
+		}
+		if topic := r.URL.Query().Get("topic"); topic != "" {
+			c.Subscribe(topic)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func dial(t *testing.T, srv *httptest.Server, query string) *websocket.Conn {
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ws.Close() })
+
+	return ws
+}
+
+func read(t *testing.T, ws *websocket.Conn) string {
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+// 读取到关闭帧 返回关闭码
+func readClose(t *testing.T, ws *websocket.Conn) int {
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			if ce, ok := err.(*websocket.CloseError); ok {
+				return ce.Code
+			}
+			t.Fatal(err)
+		}
+	}
+}
+
+// 等待连接数 注册在服务端goroutine中进行
+func waitCount(t *testing.T, h *Hub, n int) {
+	deadline := time.Now().Add(time.Second)
+	for h.Count() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("连接数 %d 期望 %d", h.Count(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	h := New(Options{})
+	srv := hubServer(t, h)
+
+	a := dial(t, srv, "id=a&room=lobby")
+	b := dial(t, srv, "id=b&room=game")
+	waitCount(t, h, 2)
+
+	if h.Get("a") == nil || h.RoomCount("lobby") != 1 || h.RoomCount("game") != 1 {
+		t.Fatal("注册或加入房间失败")
+	}
+
+	h.BroadcastRoom("lobby", []byte("lobby"))
+	h.Broadcast([]byte("all"))
+	if got := read(t, a); got != "lobby" {
+		t.Errorf("a 收到 %q", got)
+	}
+	if got := read(t, a); got != "all" {
+		t.Errorf("a 收到 %q", got)
+	}
+	if got := read(t, b); got != "all" {
+		t.Errorf("b 收到 %q 房间消息不应发给其他房间", got)
+	}
+
+	if err := h.Get("b").SendJson(map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, b); got != `{"n":1}` {
+		t.Errorf("SendJson %q", got)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	h := New(Options{})
+	srv := hubServer(t, h)
+
+	exact := dial(t, srv, "topic=order.paid")
+	prefix := dial(t, srv, "topic=order.*")
+	all := dial(t, srv, "topic=*")
+	other := dial(t, srv, "topic=user.*")
+	waitCount(t, h, 4)
+
+	h.Publish("order.paid", []byte("paid"))
+	for _, ws := range []*websocket.Conn{exact, prefix, all} {
+		if got := read(t, ws); got != "paid" {
+			t.Errorf("收到 %q", got)
+		}
+	}
+
+	h.Publish("user.login", []byte("login"))
+	if got := read(t, other); got != "login" {
+		t.Errorf("user.* 收到 %q 不应收到order主题", got)
+	}
+
+	cases := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.*", "a.b.c", true},
+		{"a.*", "ab", false},
+		{"a.*", "a", false},
+		{"*", "x", true},
+	}
+	for _, c := range cases {
+		if got := topicMatch(c.pattern, c.topic); got != c.want {
+			t.Errorf("topicMatch(%q, %q) = %v", c.pattern, c.topic, got)
+		}
+	}
+}
+
+func TestReplaceId(t *testing.T) {
+	h := New(Options{})
+	srv := hubServer(t, h)
+
+	old := dial(t, srv, "id=u1")
+	waitCount(t, h, 1)
+	first := h.Get("u1")
+
+	_ = dial(t, srv, "id=u1")
+	if code := readClose(t, old); code != websocket.CloseNormalClosure {
+		t.Errorf("旧连接关闭码 %d", code)
+	}
+	waitCount(t, h, 1)
+	if c := h.Get("u1"); c == nil || c == first {
+		t.Error("同id的新连接未替换旧连接")
+	}
+}
+
+func TestOnMessagePanic(t *testing.T) {
+	h := New(Options{})
+	h.OnMessage(func(c *Conn, msgType int, data []byte) {
+		if string(data) == "panic" {
+			panic("boom")
+		}
+		_ = c.Send(data)
+	})
+	closed := make(chan string, 1)
+	h.OnClose(func(c *Conn) { closed <- c.Id })
+	srv := hubServer(t, h)
+
+	bad := dial(t, srv, "id=bad")
+	good := dial(t, srv, "id=good")
+	waitCount(t, h, 2)
+
+	if err := bad.WriteMessage(websocket.TextMessage, []byte("panic")); err != nil {
+		t.Fatal(err)
+	}
+	if code := readClose(t, bad); code != websocket.CloseInternalServerErr {
+		t.Errorf("panic连接关闭码 %d 期望 %d", code, websocket.CloseInternalServerErr)
+	}
+	select {
+	case id := <-closed:
+		if id != "bad" {
+			t.Errorf("关闭了 %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未触发OnClose")
+	}
+
+	//其他连接继续工作
+	if err := good.WriteMessage(websocket.TextMessage, []byte("echo")); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, good); got != "echo" {
+		t.Errorf("echo %q", got)
+	}
+	if h.Count() != 1 || h.Get("good") == nil {
+		t.Errorf("连接数 %d", h.Count())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	h := New(Options{})
+	srv := hubServer(t, h)
+
+	a := dial(t, srv, "id=a")
+	b := dial(t, srv, "id=b")
+	waitCount(t, h, 2)
+
+	_ = h.Get("a").Send([]byte("last"))
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		done <- h.Shutdown(ctx)
+	}()
+
+	if got := read(t, a); got != "last" {
+		t.Errorf("关闭前未发送缓冲中的消息 %q", got)
+	}
+	for _, ws := range []*websocket.Conn{a, b} {
+		if code := readClose(t, ws); code != websocket.CloseGoingAway {
+			t.Errorf("关闭码 %d", code)
+		}
+		_ = ws.Close()
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if h.Count() != 0 {
+		t.Errorf("关闭后连接数 %d", h.Count())
+	}
+
+	//关闭后注册的连接直接关闭
+	c := dial(t, srv, "id=c")
+	if code := readClose(t, c); code != websocket.CloseGoingAway {
+		t.Errorf("关闭后注册的连接关闭码 %d", code)
+	}
+}
@@ -0,0 +1,709 @@
+package mCtx
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	jsoniter "github.com/json-iterator/go"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+/**
+结构体绑定与校验
+	type UserReq struct {
+		Name   string   `form:"name" json:"name" dec:"用户名" valid:"required,min=2,max=20"`
+		Mobile string   `form:"mobile" json:"mobile" dec:"手机号" valid:"required,mobile"`
+		Age    int      `form:"age" json:"age" dec:"年龄" valid:"min=1,max=150"`
+		Sex    string   `form:"sex" json:"sex" valid:"oneof=m f"`
+		Tags   []string `form:"tags" json:"tags" valid:"max=5"`
+		Code   string   `form:"code" valid:"regex=^[a-z]{2,4}$"`
+	}
+
+	req := &UserReq{}
+	if err := this.Ctx.Bind(req); err != nil {
+		//err为FieldErrors时 包含全部字段的错误
+	}
+
+	数据来源 先按form标签取query与form表单 再用json body或业务参数YewuParam覆盖
+	form标签为空时使用json标签 都为空时使用字段名 json数据优先使用json标签
+	json数据中的数字、布尔值可以字符串传递 如 "age":"18"
+	valid规则以,分隔 regex需放在最后 其后的内容均作为正则
+		required 必填 请求中必须传了该字段 数字传0、布尔值传false视为已传 空字符串、空数组视为未传
+		min max 数字比较大小 字符串比较字数 切片比较个数
+		len 字符串字数或切片个数必须相等
+		oneof 以空格分隔的可选值 切片校验每个元素
+		regex 正则 mobile email idcard url为预置规则 切片校验每个元素
+	非必填字段未传时 不做其他校验
+	valid标签写错(如min=abc 不支持的规则 正则错误)属于程序错误 校验时直接panic 请求返回500
+*/
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`   //字段名 取form标签
+	Rule    string `json:"rule"`    //未通过的规则
+	Message string `json:"message"` //错误描述
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// FieldErrors 字段校验错误列表
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	msg := make([]string, 0, len(e))
+	for _, v := range e {
+		msg = append(msg, v.Message)
+	}
+
+	return strings.Join(msg, ";")
+}
+
+// 预置的正则规则
+var regPresets = map[string]string{
+	"mobile": `^1[3-9]\d{9}$`,
+	"email":  `^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`,
+	"idcard": `^[1-9]\d{5}(18|19|20)\d{2}(0[1-9]|1[0-2])(0[1-9]|[12]\d|3[01])\d{3}[\dXx]$`,
+	"url":    `^https?://[^\s/$.?#][^\s]*$`,
+}
+
+// 编译后的正则缓存
+var regCache sync.Map
+
+func compileReg(expr string) (*regexp.Regexp, error) {
+	if r, ok := regCache.Load(expr); ok {
+		return r.(*regexp.Regexp), nil
+	}
+
+	r, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regCache.Store(expr, r)
+
+	return r, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Bind 将请求参数绑定到结构体并按valid标签校验
+// 绑定失败返回普通错误 校验失败返回FieldErrors
+func (c *Con) Bind(obj interface{}) error {
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("Bind参数必须为结构体指针")
+	}
+
+	//记录请求中传了的字段 用于required校验
+	present := make(map[string]bool)
+
+	//query与form表单
+	if err := bindValues(rv.Elem(), c.GetPost, present); err != nil {
+		return err
+	}
+
+	//业务参数 或 json body
+	data := c.YewuParam
+	if data == nil && c.isJsonBody() {
+		dec := jsoniter.NewDecoder(bytes.NewReader(c.BodyData))
+		dec.UseNumber()
+		if err := dec.Decode(&data); err != nil {
+			return errors.New("json数据格式错误:" + err.Error())
+		}
+	}
+	if data != nil {
+		if err := bindData(rv.Elem(), data, "", present); err != nil {
+			return err
+		}
+	}
+
+	errs := validateStruct(rv.Elem(), "", present, make(FieldErrors, 0))
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// body是否为json数据
+func (c *Con) isJsonBody() bool {
+	if len(c.BodyData) == 0 {
+		return false
+	}
+
+	if strings.Contains(c.Request.Header.Get("Content-Type"), "json") {
+		return true
+	}
+
+	b := bytes.TrimSpace(c.BodyData)
+	return len(b) > 0 && b[0] == '{' && jsoniter.Valid(b)
+}
+
+// 字段在请求参数中的名称
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("form"), ",")[0]; name != "" {
+		return name
+	}
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+
+	return f.Name
+}
+
+// 按form标签从url.Values填充结构体
+func bindValues(rv reflect.Value, values map[string][]string, present map[string]bool) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("form") == "-" { //未导出字段
+			continue
+		}
+
+		fv := rv.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type != timeType && f.Anonymous {
+			if err := bindValues(fv, values, present); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := fieldName(f)
+		vs, ok := values[name]
+		if !ok || len(vs) == 0 {
+			continue
+		}
+
+		if f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() != reflect.Uint8 {
+			list := reflect.MakeSlice(f.Type, len(vs), len(vs))
+			for k, v := range vs {
+				if err := setValue(list.Index(k), v); err != nil {
+					return errors.New(name + "格式错误:" + err.Error())
+				}
+			}
+			fv.Set(list)
+			present[name] = true
+			continue
+		}
+
+		if err := setValue(fv, vs[0]); err != nil {
+			return errors.New(name + "格式错误:" + err.Error())
+		}
+		present[name] = true
+	}
+
+	return nil
+}
+
+// 字段在json数据中的名称 json标签为空时与fieldName一致
+func jsonName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+
+	return fieldName(f)
+}
+
+// 按json标签从json数据或业务参数填充结构体 prefix为嵌套结构体的字段路径
+// 数字、布尔值可以字符串传递 与表单参数的转换规则一致
+func bindData(rv reflect.Value, data map[string]interface{}, prefix string, present map[string]bool) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" { //未导出字段
+			continue
+		}
+
+		fv := rv.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type != timeType && f.Anonymous {
+			if err := bindData(fv, data, prefix, present); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := jsonName(f)
+		if key == "-" {
+			continue
+		}
+		val, ok := lookupKey(data, key)
+		if !ok || val == nil {
+			continue
+		}
+
+		name := prefix + fieldName(f)
+		if err := setData(fv, val, name, present); err != nil {
+			return errors.New(name + "格式错误:" + err.Error())
+		}
+		present[name] = true
+	}
+
+	return nil
+}
+
+// 取json数据中的值 未找到时不区分大小写再查找一次 与json.Unmarshal一致
+func lookupKey(data map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := data[key]; ok {
+		return v, true
+	}
+
+	for k, v := range data {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+var (
+	jsonUnmarshalType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// 将json数据中的值转换为字段类型
+func setData(v reflect.Value, val interface{}, path string, present map[string]bool) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setData(p.Elem(), val, path, present); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		s, ok := scalarString(val)
+		if !ok {
+			return errors.New("时间格式错误")
+		}
+		return setValue(v, s)
+	}
+
+	//自定义解析的类型 与json.Unmarshal一致
+	pt := reflect.PtrTo(v.Type())
+	if pt.Implements(jsonUnmarshalType) || pt.Implements(textUnmarshalType) {
+		return convertJson(v, val)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return errors.New("不是对象")
+		}
+		return bindData(v, m, path+".", present)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 { //[]byte为base64字符串
+			return convertJson(v, val)
+		}
+		vs, ok := val.([]interface{})
+		if !ok {
+			return errors.New("不是数组")
+		}
+		list := reflect.MakeSlice(v.Type(), len(vs), len(vs))
+		for k, e := range vs {
+			if e == nil {
+				continue
+			}
+			if err := setData(list.Index(k), e, path+"."+strconv.Itoa(k), present); err != nil {
+				return err
+			}
+		}
+		v.Set(list)
+		return nil
+	case reflect.Map, reflect.Interface, reflect.Array:
+		return convertJson(v, val)
+	}
+
+	s, ok := scalarString(val)
+	if !ok {
+		return errors.New("不支持的数据类型")
+	}
+
+	return setValue(v, s)
+}
+
+// json数据中的数字 字符串 布尔值转为字符串
+func scalarString(val interface{}) (string, bool) {
+	switch s := val.(type) {
+	case string:
+		return s, true
+	case json.Number:
+		return s.String(), true
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(s), true
+	}
+
+	return "", false
+}
+
+// 复杂类型重新序列化后按json解析
+func convertJson(v reflect.Value, val interface{}) error {
+	b, err := jsoniter.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	return jsoniter.Unmarshal(b, v.Addr().Interface())
+}
+
+// 将字符串转换为字段类型
+func setValue(v reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+
+	if v.Type() == timeType {
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return errors.New("时间格式错误")
+	}
+
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			return nil
+		}
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("不是整数")
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			return nil
+		}
+		i, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("不是非负整数")
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.New("不是数字")
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		if s == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("不是布尔值")
+		}
+		v.SetBool(b)
+	default:
+		return errors.New("不支持的类型" + v.Type().String())
+	}
+
+	return nil
+}
+
+// Validate 按valid标签校验结构体 返回全部字段的错误
+// 不经过Bind时无法得知字段是否传了 required按零值判断 可使用指针类型区分未传与0
+func Validate(obj interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(obj))
+	if rv.Kind() != reflect.Struct {
+		return errors.New("Validate参数必须为结构体")
+	}
+
+	errs := validateStruct(rv, "", nil, make(FieldErrors, 0))
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// present为Bind记录的已传字段 为nil时按零值判断
+func validateStruct(rv reflect.Value, prefix string, present map[string]bool, errs FieldErrors) FieldErrors {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		fv := rv.Field(i)
+		name := prefix + fieldName(f)
+
+		if tag := f.Tag.Get("valid"); tag != "" && tag != "-" {
+			if e := validateField(fv, name, f.Tag.Get("dec"), parseRules(tag), provided(fv, name, present)); e != nil {
+				errs = append(errs, e)
+				continue
+			}
+		}
+
+		//嵌套结构体
+		sv := reflect.Indirect(fv)
+		if sv.Kind() == reflect.Struct && sv.Type() != timeType {
+			if f.Anonymous {
+				errs = validateStruct(sv, prefix, present, errs)
+			} else {
+				errs = validateStruct(sv, name+".", present, errs)
+			}
+		}
+	}
+
+	return errs
+}
+
+// 字段是否传了值 空字符串、空数组、nil视为未传 数字与布尔值传了0或false也视为已传
+func provided(fv reflect.Value, name string, present map[string]bool) bool {
+	switch fv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if fv.IsNil() {
+			return false
+		}
+	case reflect.String, reflect.Slice, reflect.Map:
+		if fv.Len() == 0 {
+			return false
+		}
+	}
+
+	if present == nil {
+		return !fv.IsZero()
+	}
+
+	return present[name]
+}
+
+// 单条校验规则
+type validRule struct {
+	name  string
+	param string
+	limit float64        //min max len的值
+	reg   *regexp.Regexp //regex与预置规则
+}
+
+// 解析后的valid标签
+type validRules struct {
+	required bool
+	list     []validRule
+}
+
+// 解析后的valid标签 按标签内容缓存
+var rulesCache sync.Map
+
+// 解析valid标签 标签写错属于程序错误 直接panic 不作为请求参数错误返回
+func parseRules(tag string) *validRules {
+	if r, ok := rulesCache.Load(tag); ok {
+		return r.(*validRules)
+	}
+
+	rules := tag
+	//regex放在最后 其中可能包含,
+	regex := ""
+	if i := strings.Index(rules, "regex="); i >= 0 {
+		regex = rules[i+len("regex="):]
+		rules = rules[:i]
+	}
+
+	vr := &validRules{}
+	for _, v := range strings.Split(rules, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if v == "required" {
+			vr.required = true
+			continue
+		}
+
+		r := validRule{name: v}
+		if i := strings.Index(v, "="); i >= 0 {
+			r.name, r.param = v[:i], v[i+1:]
+		}
+
+		switch r.name {
+		case "min", "max", "len":
+			limit, err := strconv.ParseFloat(r.param, 64)
+			if err != nil || (r.name == "len" && limit != float64(int(limit))) {
+				panic("valid标签错误:" + tag + " " + v)
+			}
+			r.limit = limit
+		case "oneof":
+			if len(strings.Fields(r.param)) == 0 {
+				panic("valid标签错误:" + tag + " " + v)
+			}
+		default:
+			expr, ok := regPresets[r.name]
+			if !ok {
+				panic("valid标签错误:" + tag + " 不支持的校验规则" + r.name)
+			}
+			r.reg, _ = compileReg(expr)
+		}
+		vr.list = append(vr.list, r)
+	}
+
+	if regex != "" {
+		reg, err := compileReg(regex)
+		if err != nil {
+			panic("valid标签错误:" + tag + " " + err.Error())
+		}
+		vr.list = append(vr.list, validRule{name: "regex", param: regex, reg: reg})
+	}
+
+	rulesCache.Store(tag, vr)
+	return vr
+}
+
+// 按规则校验单个字段 返回第一个未通过的规则
+func validateField(fv reflect.Value, name string, dec string, rules *validRules, provided bool) *FieldError {
+	if dec == "" {
+		dec = name
+	}
+
+	fail := func(rule string, msg string) *FieldError {
+		return &FieldError{Field: name, Rule: rule, Message: dec + msg}
+	}
+
+	//未传时不做其他校验
+	if !provided {
+		if rules.required {
+			return fail("required", "不能为空")
+		}
+		return nil
+	}
+	fv = reflect.Indirect(fv)
+
+	for _, r := range rules.list {
+		switch r.name {
+		case "min", "max":
+			n, unit, ok := measure(fv)
+			if !ok {
+				continue
+			}
+			if r.name == "min" && n < r.limit {
+				return fail(r.name, minMsg(unit, r.param))
+			}
+			if r.name == "max" && n > r.limit {
+				return fail(r.name, maxMsg(unit, r.param))
+			}
+		case "len":
+			n, unit, ok := measure(fv)
+			if ok && unit != "" && n != r.limit {
+				return fail(r.name, "必须为"+r.param+unit)
+			}
+		case "oneof":
+			opts := strings.Fields(r.param)
+			for _, s := range toStrings(fv) {
+				if !hasString(opts, s) {
+					return fail(r.name, "必须为"+strings.Join(opts, "、")+"之一")
+				}
+			}
+		default: //regex与预置规则
+			for _, s := range toStrings(fv) {
+				if !r.reg.MatchString(s) {
+					return fail(r.name, "格式错误")
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// 切片与数组逐个校验元素
+func toStrings(v reflect.Value) []string {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []string{toString(v)}
+	}
+
+	ret := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		ret = append(ret, toString(reflect.Indirect(v.Index(i))))
+	}
+
+	return ret
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 获取用于min max len比较的值 数字为值本身 字符串为字数 切片为个数
+func measure(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "个字", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "个", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+
+	return 0, "", false
+}
+
+func minMsg(unit string, param string) string {
+	if unit == "" {
+		return "不能小于" + param
+	}
+
+	return "最少" + param + unit
+}
+
+func maxMsg(unit string, param string) string {
+	if unit == "" {
+		return "不能大于" + param
+	}
+
+	return "最多" + param + unit
+}
+
+// 字段值转为字符串 用于oneof与正则校验
+func toString(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+
+	return ""
+}
@@ -0,0 +1,184 @@
+package mCtx
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindAddr struct {
+	City string `json:"city" dec:"城市" valid:"required"`
+}
+
+type bindReq struct {
+	Name   string    `form:"name" json:"name" dec:"用户名" valid:"required,min=2,max=5"`
+	Age    int       `form:"age" json:"age" dec:"年龄" valid:"required,max=150"`
+	Vip    bool      `form:"vip" json:"vip" dec:"会员" valid:"required"`
+	Score  float64   `form:"score" json:"score" valid:"min=-10,max=10"`
+	Sex    string    `form:"sex" json:"sex" valid:"oneof=m f"`
+	Tags   []string  `form:"tags" json:"tags" valid:"max=2,oneof=a b c"`
+	Mobile string    `form:"mobile" json:"mobile" valid:"mobile"`
+	Code   string    `form:"code" json:"code" valid:"len=3,regex=^[a-z,]+$"`
+	Birth  time.Time `form:"birth" json:"birth"`
+	Addr   *bindAddr `json:"addr"`
+}
+
+func bindCon(method string, form url.Values, body string) *Con {
+	r := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	return &Con{Request: r, GetPost: form, BodyData: []byte(body)}
+}
+
+// 返回未通过校验的字段与规则 如 name:min
+func failedRules(err error) []string {
+	errs, ok := err.(FieldErrors)
+	if !ok {
+		return nil
+	}
+
+	ret := make([]string, 0, len(errs))
+	for _, v := range errs {
+		ret = append(ret, v.Field+":"+v.Rule)
+	}
+
+	return ret
+}
+
+func TestBindForm(t *testing.T) {
+	c := bindCon("GET", url.Values{
+		"name":  {"张三"},
+		"age":   {"0"},
+		"vip":   {"false"},
+		"score": {"-3.5"},
+		"tags":  {"a", "c"},
+		"birth": {"2024-01-02"},
+	}, "")
+
+	req := &bindReq{}
+	if err := c.Bind(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "张三" || req.Age != 0 || req.Vip || req.Score != -3.5 || !reflect.DeepEqual(req.Tags, []string{"a", "c"}) || req.Birth.Format("2006-01-02") != "2024-01-02" {
+		t.Errorf("req = %+v", req)
+	}
+
+	//格式错误为普通错误
+	err := bindCon("GET", url.Values{"age": {"abc"}}, "").Bind(&bindReq{})
+	if err == nil || failedRules(err) != nil {
+		t.Errorf("bad int: %v", err)
+	}
+}
+
+func TestBindJson(t *testing.T) {
+	//数字与布尔值可以字符串传递 json标签不区分大小写
+	c := bindCon("POST", url.Values{"name": {"form"}, "sex": {"m"}},
+		`{"name":"json","AGE":"18","vip":"true","score":1e1,"tags":["b"],"birth":"2024-01-02 10:00:00","addr":{"city":"北京"}}`)
+
+	req := &bindReq{}
+	if err := c.Bind(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "json" || req.Age != 18 || !req.Vip || req.Score != 10 || req.Sex != "m" || req.Addr == nil || req.Addr.City != "北京" {
+		t.Errorf("req = %+v", req)
+	}
+
+	//业务参数 json解析后数字为float64
+	c = bindCon("POST", nil, "")
+	c.YewuParam = YewuParam{"name": "yewu", "age": float64(20), "vip": false}
+	req = &bindReq{}
+	if err := c.Bind(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "yewu" || req.Age != 20 || req.Vip {
+		t.Errorf("yewu req = %+v", req)
+	}
+
+	for _, body := range []string{`{"age":"x"}`, `{"tags":"a"}`, `{"addr":1}`, `{"name":`} {
+		err := bindCon("POST", nil, body).Bind(&bindReq{})
+		if err == nil || failedRules(err) != nil {
+			t.Errorf("%s: %v", body, err)
+		}
+	}
+}
+
+func TestBindValid(t *testing.T) {
+	base := `"name":"张三","age":1,"vip":false`
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{` + base + `}`, nil},
+		//required按是否传了判断 0与false视为已传
+		{`{"name":"","age":0}`, []string{"name:required", "vip:required"}},
+		{`{"name":"张三李四王五","age":151,"vip":true}`, []string{"name:max", "age:max"}},
+		{`{` + base + `,"score":-11}`, []string{"score:min"}},
+		{`{` + base + `,"score":-10}`, nil},
+		{`{` + base + `,"sex":"x"}`, []string{"sex:oneof"}},
+		{`{` + base + `,"tags":["a","d"]}`, []string{"tags:oneof"}},
+		{`{` + base + `,"tags":["a","b","c"]}`, []string{"tags:max"}},
+		{`{` + base + `,"mobile":"123"}`, []string{"mobile:mobile"}},
+		{`{` + base + `,"mobile":"13800138000"}`, nil},
+		{`{` + base + `,"code":"ab"}`, []string{"code:len"}},
+		{`{` + base + `,"code":"A,B"}`, []string{"code:regex"}},
+		{`{` + base + `,"code":"a,b"}`, nil},
+		//嵌套结构体
+		{`{` + base + `,"addr":{}}`, []string{"addr.city:required"}},
+	}
+
+	for _, v := range tests {
+		got := failedRules(bindCon("POST", nil, v.body).Bind(&bindReq{}))
+		if len(got) != len(v.want) || (len(got) > 0 && !reflect.DeepEqual(got, v.want)) {
+			t.Errorf("%s: got %v want %v", v.body, got, v.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	//未经过Bind时required按零值判断
+	type req struct {
+		Age   int  `json:"age" valid:"required"`
+		Count *int `json:"count" valid:"required,min=0"`
+	}
+
+	zero := 0
+	if got := failedRules(Validate(&req{Count: &zero})); !reflect.DeepEqual(got, []string{"age:required"}) {
+		t.Errorf("got %v", got)
+	}
+	if got := failedRules(Validate(req{Age: 1})); !reflect.DeepEqual(got, []string{"count:required"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestValidTagPanic(t *testing.T) {
+	tests := []interface{}{
+		&struct {
+			A int `valid:"min=abc"`
+		}{A: 1},
+		&struct {
+			A string `valid:"phone"`
+		}{A: "1"},
+		&struct {
+			A string `valid:"regex=^[a-z$"`
+		}{A: "1"},
+		&struct {
+			A string `valid:"oneof="`
+		}{A: "1"},
+	}
+
+	for _, v := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%T: no panic", v)
+				}
+			}()
+			_ = Validate(v)
+		}()
+	}
+}
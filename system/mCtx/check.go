@@ -0,0 +1,239 @@
+package mCtx
+
+import (
+	"errors"
+	"github.com/solaa51/zoo/system/config"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/**
+CheckField扩展类型
+	CHECK_FLOAT 返回float64 MinFloat MaxFloat为取值范围 均为0时不限制 可为负数
+	CHECK_BOOL 返回bool 支持 1 0 true false on off yes no
+	CHECK_DATE 返回time.Time 格式由Format指定 默认2006-01-02
+	CHECK_ENUM 返回string 值必须在Enum中
+	CHECK_INT_SLICE CHECK_STRING_SLICE 返回[]int64 []string Min Max为个数范围
+		GetPost中可传多个同名参数或以,分隔 YewuParam中可为数组或以,分隔的字符串
+
+	Reg 正则校验 可使用预置规则名 mobile email idcard url 多个预置规则用|分割 满足其一即可
+		仅作用于CHECK_FLOAT CHECK_STRING_SLICE CHECK_INT CHECK_STRING保持原有的校验方式
+*/
+
+// 获取参数的原始值 统一转换为字符串列表
+func (c *Con) fieldValues(f *CheckField) []string {
+	yewu := f.Yewu && !(config.Info().Env == "test" && c.YewuParam == nil) //本地环境时使用GetPost
+
+	list := make([]string, 0)
+	if !yewu {
+		for _, v := range c.GetPost[f.Name] {
+			list = append(list, strings.TrimSpace(v))
+		}
+		return list
+	}
+
+	switch val := c.YewuParam[f.Name].(type) {
+	case nil:
+	case []interface{}:
+		for _, v := range val {
+			list = append(list, strings.TrimSpace(yewuString(v)))
+		}
+	default:
+		list = append(list, strings.TrimSpace(yewuString(val)))
+	}
+
+	return list
+}
+
+// 业务参数转为字符串
+func yewuString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case nil:
+		return ""
+	}
+
+	return ""
+}
+
+// 扩展类型的检查
+func (c *Con) checkExtra(f *CheckField) (interface{}, error) {
+	list := c.fieldValues(f)
+
+	//列表类型 值中包含,时拆分
+	slice := f.Tpe == CHECK_INT_SLICE || f.Tpe == CHECK_STRING_SLICE
+	if slice {
+		list = strings.Split(strings.Join(list, ","), ",")
+	}
+
+	vals := make([]string, 0, len(list))
+	for _, v := range list {
+		if v = strings.TrimSpace(v); v != "" {
+			vals = append(vals, v)
+		}
+	}
+
+	if len(vals) == 0 {
+		if f.Request {
+			return nil, errors.New(f.Dec + "不能为空")
+		}
+		if f.Def == "" {
+			return emptyValue(f.Tpe), nil
+		}
+		vals = []string{f.Def}
+		if slice {
+			vals = strings.Split(f.Def, ",")
+		}
+	}
+
+	switch f.Tpe {
+	case CHECK_FLOAT:
+		num, err := strconv.ParseFloat(vals[0], 64)
+		if err != nil {
+			return nil, errors.New(f.Dec + "必须为数字")
+		}
+		if f.MinFloat != 0 || f.MaxFloat != 0 {
+			if num < f.MinFloat {
+				return nil, errors.New(f.Dec + "不能小于" + strconv.FormatFloat(f.MinFloat, 'f', -1, 64))
+			}
+			if num > f.MaxFloat {
+				return nil, errors.New(f.Dec + "不能大于" + strconv.FormatFloat(f.MaxFloat, 'f', -1, 64))
+			}
+		}
+		if err = f.regCheck(vals[0]); err != nil {
+			return nil, err
+		}
+		return num, nil
+	case CHECK_BOOL:
+		switch strings.ToLower(vals[0]) {
+		case "1", "t", "true", "on", "yes":
+			return true, nil
+		case "0", "f", "false", "off", "no":
+			return false, nil
+		}
+		return nil, errors.New(f.Dec + "必须为布尔值")
+	case CHECK_DATE:
+		format := f.Format
+		if format == "" {
+			format = "2006-01-02"
+		}
+		t, err := time.ParseInLocation(format, vals[0], time.Local)
+		if err != nil {
+			return nil, errors.New(f.Dec + "格式必须为" + format)
+		}
+		return t, nil
+	case CHECK_ENUM:
+		for _, v := range f.Enum {
+			if v == vals[0] {
+				return v, nil
+			}
+		}
+		return nil, errors.New(f.Dec + "必须为" + strings.Join(f.Enum, "、") + "之一")
+	case CHECK_INT_SLICE:
+		if err := f.countCheck(len(vals)); err != nil {
+			return nil, err
+		}
+		ret := make([]int64, 0, len(vals))
+		for _, v := range vals {
+			num, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, errors.New(f.Dec + "必须为整数列表")
+			}
+			ret = append(ret, num)
+		}
+		return ret, nil
+	case CHECK_STRING_SLICE:
+		if err := f.countCheck(len(vals)); err != nil {
+			return nil, err
+		}
+		for _, v := range vals {
+			if utf8.RuneCountInString(v) > 65535 {
+				return nil, errors.New(f.Dec + "最多65535个字")
+			}
+			if err := f.regCheck(v); err != nil {
+				return nil, err
+			}
+		}
+		return vals, nil
+	}
+
+	return nil, errors.New("暂不支持的数据类型检测")
+}
+
+// 未传参数且无默认值时返回的零值
+func emptyValue(tpe checkType) interface{} {
+	switch tpe {
+	case CHECK_FLOAT:
+		return float64(0)
+	case CHECK_BOOL:
+		return false
+	case CHECK_DATE:
+		return time.Time{}
+	case CHECK_INT_SLICE:
+		return []int64{}
+	case CHECK_STRING_SLICE:
+		return []string{}
+	}
+
+	return ""
+}
+
+// 列表个数检查
+func (f *CheckField) countCheck(num int) error {
+	if f.Min > 0 && int64(num) < f.Min {
+		return errors.New(f.Dec + "最少" + strconv.FormatInt(f.Min, 10) + "个")
+	}
+	if f.Max > 0 && int64(num) > f.Max {
+		return errors.New(f.Dec + "最多" + strconv.FormatInt(f.Max, 10) + "个")
+	}
+
+	return nil
+}
+
+// 正则校验 值为空时不校验
+func (f *CheckField) regCheck(value string) error {
+	if f.Reg == "" || value == "" {
+		return nil
+	}
+
+	//预置规则 多个满足其一即可
+	names := strings.Split(f.Reg, "|")
+	preset := true
+	for _, v := range names {
+		if _, ok := regPresets[v]; !ok {
+			preset = false
+			break
+		}
+	}
+	if !preset {
+		names = []string{f.Reg}
+	}
+
+	for _, v := range names {
+		expr := v
+		if preset {
+			expr = regPresets[v]
+		}
+
+		r, err := compileReg(expr)
+		if err != nil {
+			return errors.New(f.Dec + "校验规则错误")
+		}
+		if r.MatchString(value) {
+			return nil
+		}
+	}
+
+	return errors.New(f.Dec + "格式错误")
+}
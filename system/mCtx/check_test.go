@@ -0,0 +1,98 @@
+package mCtx
+
+import (
+	"math"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckField(t *testing.T) {
+	c := &Con{GetPost: url.Values{
+		"id":    {"5"},
+		"name":  {"abc"},
+		"price": {"-3.5"},
+		"on":    {"yes"},
+		"day":   {"2024-01-02"},
+		"sort":  {"desc"},
+		"ids":   {"1,2", "3"},
+		"tels":  {"13800138000", "13900139000"},
+	}}
+	c.YewuParam = YewuParam{"uids": []interface{}{float64(7), "8"}}
+
+	ret, err := c.CheckField([]*CheckField{
+		//CHECK_INT CHECK_STRING不使用Reg
+		{Name: "id", Dec: "id", Tpe: CHECK_INT, Reg: "mobile"},
+		{Name: "name", Dec: "名称", Tpe: CHECK_STRING, Reg: "email"},
+		//未设置MinFloat MaxFloat时不限制 可为负数
+		{Name: "price", Dec: "价格", Tpe: CHECK_FLOAT},
+		{Name: "on", Dec: "开关", Tpe: CHECK_BOOL},
+		{Name: "day", Dec: "日期", Tpe: CHECK_DATE},
+		{Name: "sort", Dec: "排序", Tpe: CHECK_ENUM, Enum: []string{"asc", "desc"}},
+		{Name: "ids", Dec: "id列表", Tpe: CHECK_INT_SLICE, Min: 1, Max: 3},
+		{Name: "tels", Dec: "手机号", Tpe: CHECK_STRING_SLICE, Reg: "mobile"},
+		{Name: "uids", Dec: "用户", Tpe: CHECK_INT_SLICE, Yewu: true},
+		{Name: "rate", Dec: "比例", Tpe: CHECK_FLOAT, Def: "0.5"},
+		{Name: "tags", Dec: "标签", Tpe: CHECK_STRING_SLICE},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day, _ := time.ParseInLocation("2006-01-02", "2024-01-02", time.Local)
+	want := map[string]interface{}{
+		"id":    int64(5),
+		"name":  "abc",
+		"price": -3.5,
+		"on":    true,
+		"day":   day,
+		"sort":  "desc",
+		"ids":   []int64{1, 2, 3},
+		"tels":  []string{"13800138000", "13900139000"},
+		"uids":  []int64{7, 8},
+		"rate":  0.5,
+		"tags":  []string{},
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(ret[k], v) {
+			t.Errorf("%s = %#v, want %#v", k, ret[k], v)
+		}
+	}
+}
+
+func TestCheckFieldError(t *testing.T) {
+	c := &Con{GetPost: url.Values{
+		"price": {"-3.5"},
+		"on":    {"maybe"},
+		"day":   {"2024/01/02"},
+		"sort":  {"up"},
+		"ids":   {"1,a"},
+		"tels":  {"13800138000,123"},
+	}}
+
+	tests := []struct {
+		field *CheckField
+		msg   string
+	}{
+		{&CheckField{Name: "price", Dec: "价格", Tpe: CHECK_FLOAT, MinFloat: -1, MaxFloat: 1}, "价格不能小于-1"},
+		{&CheckField{Name: "price", Dec: "价格", Tpe: CHECK_FLOAT, MinFloat: -10, MaxFloat: -4}, "价格不能大于-4"},
+		{&CheckField{Name: "price", Dec: "价格", Tpe: CHECK_FLOAT, MaxFloat: math.Inf(1)}, "价格不能小于0"},
+		{&CheckField{Name: "price", Dec: "价格", Tpe: CHECK_FLOAT, Reg: `^\d+$`}, "价格格式错误"},
+		{&CheckField{Name: "on", Dec: "开关", Tpe: CHECK_BOOL}, "开关必须为布尔值"},
+		{&CheckField{Name: "day", Dec: "日期", Tpe: CHECK_DATE}, "日期格式必须为2006-01-02"},
+		{&CheckField{Name: "sort", Dec: "排序", Tpe: CHECK_ENUM, Enum: []string{"asc", "desc"}}, "排序必须为asc、desc之一"},
+		{&CheckField{Name: "ids", Dec: "id列表", Tpe: CHECK_INT_SLICE}, "id列表必须为整数列表"},
+		{&CheckField{Name: "ids", Dec: "id列表", Tpe: CHECK_INT_SLICE, Max: 1}, "id列表最多1个"},
+		{&CheckField{Name: "ids", Dec: "id列表", Tpe: CHECK_INT_SLICE, Min: 3}, "id列表最少3个"},
+		{&CheckField{Name: "tels", Dec: "手机号", Tpe: CHECK_STRING_SLICE, Reg: "mobile|email"}, "手机号格式错误"},
+		{&CheckField{Name: "none", Dec: "必填", Tpe: CHECK_DATE, Request: true}, "必填不能为空"},
+	}
+
+	for _, v := range tests {
+		_, err := c.CheckField([]*CheckField{v.field})
+		if err == nil || err.Error() != v.msg {
+			t.Errorf("%+v: err = %v, want %s", v.field, err, v.msg)
+		}
+	}
+}
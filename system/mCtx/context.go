@@ -0,0 +1,132 @@
+package mCtx
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+/**
+Con实现了context.Context 可直接传入orm、cFunc等需要context的调用
+超时、客户端断开时Done()会被关闭
+Value可获取请求ID以及签名验证通过的app_key
+*/
+
+type ctxKey int
+
+const (
+	RequestIdKey ctxKey = iota //请求ID
+	AppKeyKey                  //签名验证通过的app_key
+	ConnKey                    //请求所在的连接 由gHttp在建立连接时设置
+	MtlsKey                    //请求所在的服务开启了mTLS 由gHttp在建立连接时设置
+)
+
+// RequestIdFrom 从context中获取请求ID
+func RequestIdFrom(ctx context.Context) string {
+	s, _ := ctx.Value(RequestIdKey).(string)
+	return s
+}
+
+// AppKeyFrom 从context中获取签名验证通过的app_key
+func AppKeyFrom(ctx context.Context) string {
+	s, _ := ctx.Value(AppKeyKey).(string)
+	return s
+}
+
+// WithConn 将连接放入context 用于http.Server的ConnContext
+func WithConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, ConnKey, conn)
+}
+
+// ConnFrom 从context中获取请求所在的连接
+func ConnFrom(ctx context.Context) net.Conn {
+	c, _ := ctx.Value(ConnKey).(net.Conn)
+	return c
+}
+
+// SetWriteDeadline 设置响应的写超时 与go1.20的http.ResponseController一致
+// 依次查找ResponseWriter以及Unwrap()返回的ResponseWriter中的SetWriteDeadline
+// go1.20起http/1.x与http/2的ResponseWriter均已实现 都未实现时返回http.ErrNotSupported
+func SetWriteDeadline(w http.ResponseWriter, deadline time.Time) error {
+	for {
+		switch t := w.(type) {
+		case interface{ SetWriteDeadline(time.Time) error }:
+			return t.SetWriteDeadline(deadline)
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return http.ErrNotSupported
+		}
+	}
+}
+
+// 取消写超时 sse等长连接不受http.Server的WriteTimeout限制
+// ResponseWriter不支持时设置连接的写超时 只对http/1.x有效 http/2的连接由多个请求共用
+func (c *Con) clearWriteDeadline() {
+	if SetWriteDeadline(c.ResponseWriter, time.Time{}) == nil {
+		return
+	}
+
+	if conn := ConnFrom(c.Request.Context()); conn != nil && c.Request.ProtoMajor == 1 {
+		_ = conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// WithMtls 标记连接所在的服务开启了mTLS 用于http.Server的ConnContext
+func WithMtls(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(WithConn(ctx, conn), MtlsKey, true)
+}
+
+// MtlsFrom 请求所在的服务是否开启了mTLS
+func MtlsFrom(ctx context.Context) bool {
+	b, _ := ctx.Value(MtlsKey).(bool)
+	return b
+}
+
+// Context 返回请求的context 超时或客户端断开时会被取消
+// 耗时操作应监听Done()及时退出
+func (c *Con) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+
+	return c.Request.Context()
+}
+
+// SetContext 替换请求的context Request同步替换
+func (c *Con) SetContext(ctx context.Context) {
+	c.ctx = ctx
+	c.Request = c.Request.WithContext(ctx)
+}
+
+func (c *Con) Deadline() (time.Time, bool) {
+	return c.Context().Deadline()
+}
+
+func (c *Con) Done() <-chan struct{} {
+	return c.Context().Done()
+}
+
+func (c *Con) Err() error {
+	return c.Context().Err()
+}
+
+func (c *Con) Value(key interface{}) interface{} {
+	return c.Context().Value(key)
+}
+
+// 将请求ID app_key写入请求的context
+func (c *Con) initContext() {
+	ctx := context.WithValue(c.Context(), RequestIdKey, c.RequestId)
+	if c.CommonParam.AppKey != "" {
+		ctx = context.WithValue(ctx, AppKeyKey, c.CommonParam.AppKey)
+	}
+
+	c.SetContext(ctx)
+}
+
+// Param 获取路由规则中的命名参数 不存在时返回空字符串
+func (c *Con) Param(name string) string {
+	return c.RouteParams[name]
+}
@@ -1,8 +1,10 @@
 package mCtx
 
 import (
+	"bytes"
+	"context"
+	"crypto/x509"
 	"errors"
-	"fmt"
 	"github.com/gorilla/websocket"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/solaa51/zoo/system/cFunc"
@@ -21,25 +23,38 @@ var (
 	// JSONRETURN 提前退出http请求使用
 	JSONRETURN = errors.New("")
 	TEXTRETURN = errors.New("")
+
+	// ErrBodyTooLarge 请求body超出配置的maxBodySize
+	ErrBodyTooLarge = errors.New("请求数据过大")
 )
 
 type Con struct {
+	ctx            context.Context //请求上下文 包含超时与取消信号
 	Request        *http.Request
 	ResponseWriter http.ResponseWriter
 	RequestId      string //分布式唯一ID
 
 	Header http.Header
 
-	ClassName  string
-	MethodName string
+	ClassName   string
+	MethodName  string
+	RouteParams map[string]string //路由规则中的命名参数
 
 	Post     url.Values //单纯的form-data请求数据 或者x-www-form-urlencoded请求数据
 	GetPost  url.Values //get参数与 form-data或者x-www-form-urlencoded合集
 	BodyData []byte     //body内包含的数据
+	rawBody  []byte     //原始body数据 header签名验证使用
 
 	CommonParam CommonParam //公共参数 验证签名的请求使用
 	YewuParam   YewuParam   //业务参数 验证签名的请求使用
 	Node        *snowflake.Node
+
+	ClientCert    *x509.Certificate //mTLS校验通过的客户端证书
+	ClientSubject string            //客户端证书的Subject
+
+	responded bool    //已写入返回数据
+	aborted   bool    //请求已中断 后续中间件与控制器方法不再执行
+	result    *Result //通过Json Render返回的{msg ret data}结构
 }
 
 func New(w http.ResponseWriter, r *http.Request, className string, methodName string) (*Con, error) {
@@ -51,74 +66,145 @@ func New(w http.ResponseWriter, r *http.Request, className string, methodName st
 		RequestId:      config.Info().ServerNode.NextIdStr(),
 	}
 
+	//mTLS客户端证书
+	ctx.setClientCert()
+
 	//解析请求参数 以及body数据
-	ctx.parseData()
+	if err := ctx.parseData(); err != nil {
+		return nil, err
+	}
+
+	//优先验证header中的签名信息
+	auth, err := HeaderAuth(r, ctx.rawBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth != nil {
+		ctx.setAuth(auth)
 
-	if !config.IgnoreSign(ctx.ClassName) {
+		//json数据作为业务参数
+		if len(ctx.BodyData) > 0 && ctx.BodyData[0] == '{' {
+			yData := YewuParam{}
+			if err = jsoniter.Unmarshal(ctx.BodyData, &yData); err != nil {
+				return nil, err
+			}
+			ctx.YewuParam = yData
+		}
+	} else if !config.IgnoreSign(ctx.ClassName) {
 		//查看是否包含param参数 固定格式
 		if ctx.Post["param"] == nil {
 			return nil, errors.New("缺少param参数,无法验证签名")
 		}
 	}
 
-	if ctx.Post["param"] != nil {
+	if auth == nil && ctx.Post["param"] != nil {
 		//解析参数
-		secret, err := ctx.parseParam(ctx.Post["param"][0])
+		key, err := ctx.parseParam(ctx.Post["param"][0])
 		if err != nil {
 			return nil, err
 		}
 
-		err = ctx.signCheck(secret)
+		err = ctx.signCheck(key)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	ctx.initContext()
+
 	mLog.Info("访问记录：[" + ctx.RequestId + "] start -- " + ctx.ClassName + "/" + ctx.MethodName)
 
 	return ctx, nil
 }
 
+// NewLite 构建不解析请求数据、不验证签名的请求上下文
+// 用于OPTIONS等由框架自动应答的请求 使中间件同样生效
+func NewLite(w http.ResponseWriter, r *http.Request, className string, methodName string) *Con {
+	ctx := &Con{
+		Request:        r,
+		ClassName:      className,
+		MethodName:     methodName,
+		ResponseWriter: w,
+		RequestId:      config.Info().ServerNode.NextIdStr(),
+		GetPost:        r.URL.Query(),
+		Post:           url.Values{},
+	}
+	ctx.setClientCert()
+	ctx.initContext()
+
+	return ctx
+}
+
+// NewRpc 为json-rpc调用构建请求上下文
+// params为rpc请求中的params 为对象时解析为业务参数YewuParam 为数组时由handler按位置映射为方法参数
+// auth为HeaderAuth验证通过的签名信息 未签名时为nil
+func NewRpc(w http.ResponseWriter, r *http.Request, className string, methodName string, params []byte, auth *CommonParam) (*Con, error) {
+	ctx := &Con{
+		Request:        r,
+		ClassName:      className,
+		MethodName:     methodName,
+		ResponseWriter: w,
+		RequestId:      config.Info().ServerNode.NextIdStr(),
+		GetPost:        r.URL.Query(),
+		Post:           url.Values{},
+		BodyData:       params,
+	}
+	ctx.setClientCert()
+
+	if len(params) > 0 && params[0] == '{' {
+		yData := YewuParam{}
+		err := jsoniter.Unmarshal(params, &yData)
+		if err != nil {
+			return nil, err
+		}
+		ctx.YewuParam = yData
+	}
+
+	if auth != nil {
+		ctx.setAuth(auth)
+	} else if !config.IgnoreSign(ctx.ClassName) {
+		return nil, errors.New("缺少签名信息,无法验证签名")
+	}
+
+	ctx.initContext()
+
+	mLog.Info("访问记录：[" + ctx.RequestId + "] rpc start -- " + ctx.ClassName + "/" + ctx.MethodName)
+
+	return ctx, nil
+}
+
 // 解析签名参数 验证签名
-func (c *Con) parseParam(paramData string) (string, error) {
+func (c *Con) parseParam(paramData string) (config.EncryptKey, error) {
 	data := CommonParam{}
 	err := jsoniter.Unmarshal([]byte(paramData), &data)
 	if err != nil {
-		return "", err
+		return config.EncryptKey{}, err
 	}
 
 	if data.AppKey == "" {
-		return "", errors.New("app_key不能为空")
+		return config.EncryptKey{}, errors.New("app_key不能为空")
 	}
 
 	if data.Control == "" {
-		return "", errors.New("control不能为空")
+		return config.EncryptKey{}, errors.New("control不能为空")
 	}
 
 	if data.Method == "" {
-		return "", errors.New("method不能为空")
+		return config.EncryptKey{}, errors.New("method不能为空")
 	}
 
 	if data.Ip == "" {
-		return "", errors.New("IP不能为空")
+		return config.EncryptKey{}, errors.New("IP不能为空")
 	}
 
 	if data.Sign == "" {
-		return "", errors.New("签名不能为空")
-	}
-
-	secret := ""
-	hasKey := false
-	for _, v := range config.Info().Encrypt.Keys {
-		if v.Key == data.AppKey {
-			secret = v.Value
-			hasKey = true
-			break
-		}
+		return config.EncryptKey{}, errors.New("签名不能为空")
 	}
 
+	key, hasKey := config.Info().Encrypt.Key(data.AppKey)
 	if !hasKey {
-		return "", errors.New("无效的key:" + data.AppKey)
+		return config.EncryptKey{}, errors.New("无效的key:" + data.AppKey)
 	}
 
 	c.CommonParam = data
@@ -126,57 +212,108 @@ func (c *Con) parseParam(paramData string) (string, error) {
 	yData := YewuParam{}
 	err = jsoniter.Unmarshal([]byte(data.Param), &yData)
 	if err != nil {
-		return "", err
+		return config.EncryptKey{}, err
 	}
 	c.YewuParam = yData
 
-	return secret, nil
+	return key, nil
+}
+
+// 记录header签名验证通过的公共参数
+func (c *Con) setAuth(auth *CommonParam) {
+	c.CommonParam = *auth
+	c.CommonParam.Control = c.ClassName
+	c.CommonParam.Method = c.MethodName
 }
 
-// sign 生成签名
-func (c *Con) signCheck(secret string) error {
+// sign 按app_key配置的签名方式验证签名
+func (c *Con) signCheck(key config.EncryptKey) error {
 	//是否验证签名
 	if !config.IgnoreSign(c.ClassName) {
-		str := "app_key=" + c.CommonParam.AppKey + "&" +
-			"control=" + c.CommonParam.Control + "&" +
-			"ip=" + c.CommonParam.Ip + "&" +
-			"method=" + c.CommonParam.Method + "&" +
-			"param=" + url.QueryEscape(c.CommonParam.Param) + secret
-
-		if c.CommonParam.Sign != cFunc.Md5(str) {
-			mLog.Warn(c.CommonParam.Ip + " - " + c.ClassName + "-" + c.MethodName + " 签名错误:" + str)
+		p := c.CommonParam
+		str := cFunc.ParamSignStr(p.AppKey, p.Control, p.Ip, p.Method, p.Nonce, p.Param, p.Timestamp)
+
+		if err := cFunc.VerifyKeySign(p.AppKey, key.Type, key.Value, str, p.Sign); err != nil {
+			mLog.Warn(p.Ip + " - " + c.ClassName + "-" + c.MethodName + " 签名错误:" + str + " - " + err.Error())
 			return errors.New("签名错误")
 		}
+
+		if err := replayCheck(&p, false); err != nil {
+			mLog.Warn(p.Ip + " - " + c.ClassName + "-" + c.MethodName + " - " + err.Error())
+			return err
+		}
 	}
 
 	return nil
 }
 
 // parseData 解析请求参数 以及body数据
-func (c *Con) parseData() {
-	_ = c.Request.ParseForm()                  //解析get参数
-	_ = c.Request.ParseMultipartForm(32 << 20) //解析post参数
+func (c *Con) parseData() error {
+	LimitBody(c.ResponseWriter, c.Request)
+
+	//header签名需要原始body 仅在签名时保留一份
+	if c.Request.Header.Get(cFunc.HeaderSign) != "" {
+		rawBody, err := ioutil.ReadAll(c.Request.Body)
+		_ = c.Request.Body.Close()
+		if err != nil {
+			return bodyError(err)
+		}
+		c.rawBody = rawBody
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(rawBody))
+	}
+
+	//解析get参数以及post参数 格式错误时忽略
+	if err := c.Request.ParseForm(); BodyTooLarge(err) {
+		return ErrBodyTooLarge
+	}
+	if err := c.Request.ParseMultipartForm(32 << 20); BodyTooLarge(err) {
+		return ErrBodyTooLarge
+	}
 
 	c.GetPost = c.Request.Form
 	c.Post = c.Request.PostForm
 
+	//表单数据已被解析 剩余部分为body内的数据
 	bodyData, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
-		mLog.Error("获取body数据失败", err)
+		return bodyError(err)
 	}
-	defer c.Request.Body.Close()
-
 	c.BodyData = bodyData
+
+	return nil
+}
+
+// LimitBody 按配置文件中的maxBodySize限制请求body的长度
+func LimitBody(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, config.Info().Http.MaxBodySize<<20)
+}
+
+// BodyTooLarge 读取body的错误是否为超出maxBodySize
+func BodyTooLarge(err error) bool {
+	//http.MaxBytesReader超出长度时的错误 低版本没有可判断的错误类型
+	return err != nil && strings.Contains(err.Error(), "request body too large")
+}
+
+// 读取body失败 超出长度时返回ErrBodyTooLarge
+func bodyError(err error) error {
+	if BodyTooLarge(err) {
+		return ErrBodyTooLarge
+	}
+
+	mLog.Error("获取body数据失败", err)
+	return errors.New("读取请求数据失败")
 }
 
 // CommonParam 公共参数
 type CommonParam struct {
-	AppKey  string `json:"app_key"`
-	Control string `json:"control"`
-	Method  string `json:"method"`
-	Ip      string `json:"ip"`
-	Sign    string `json:"sign"`
-	Param   string `json:"param"` //业务参数部分
+	AppKey    string `json:"app_key"`
+	Control   string `json:"control"`
+	Method    string `json:"method"`
+	Ip        string `json:"ip"`
+	Timestamp int64  `json:"timestamp"` //签名时间戳 防重放使用
+	Nonce     string `json:"nonce"`     //随机字符串 防重放使用
+	Sign      string `json:"sign"`
+	Param     string `json:"param"` //业务参数部分
 }
 
 // YewuParam 业务参数
@@ -372,61 +509,57 @@ func (c *Con) YewuParamString(param string, dec string, request bool, min int64,
 	return ps, nil
 }
 
-// WebSocket 升级请求为websocket
+// WebSocket 升级请求为websocket 跨域来源由配置文件[websocket]origins限制
+// 升级后连接可交由library/wsHub管理
 func (c *Con) WebSocket() (*websocket.Conn, error) {
-	upgrade := websocket.Upgrader{}
-	upgrade.CheckOrigin = func(r *http.Request) bool {
-		return true
+	upgrade := websocket.Upgrader{
+		CheckOrigin: checkOrigin,
 	}
 
+	//升级失败时Upgrade已写入403或400
 	conn, err := upgrade.Upgrade(c.ResponseWriter, c.Request, nil)
+	c.responded = true
+
 	return conn, err
 }
 
-func (c *Con) JsonReturn(code int, data interface{}, format string, a ...interface{}) {
-	msg := ""
-	if strings.Contains(format, "%s") || strings.Contains(format, "%d") || strings.Contains(format, "%v") || strings.Contains(format, "%t") {
-		msg = fmt.Sprintf(format, a)
-	} else {
-		msg = format
+// 检查websocket请求来源 同域名或配置中允许的来源可以通过
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
 	}
 
-	header := c.ResponseWriter.Header()
-	header.Set("Content-Type", "application/json;charset=UTF-8")
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
 
-	switch data.(type) {
-	case string:
-		if data.(string) == "" { //空字符串 替换为空struct
-			data = struct{}{}
+	for _, v := range config.Info().WebSocket.Origins {
+		switch {
+		case v == "*", strings.EqualFold(v, origin), strings.EqualFold(v, u.Host):
+			return true
+		case strings.HasPrefix(v, "*.") && strings.HasSuffix(strings.ToLower(u.Hostname()), strings.ToLower(v[1:])):
+			return true
 		}
 	}
 
-	//json返回数据
-	type JsonErr struct {
-		Msg  string      `json:"msg"`
-		Ret  int         `json:"ret"`
-		Data interface{} `json:"data"`
-	}
-	st := &JsonErr{
-		Msg:  msg,
-		Ret:  code,
-		Data: data,
-	}
+	return false
+}
 
-	b, err := jsoniter.Marshal(st)
-	if err != nil {
-		mLog.Error("访问记录：["+c.RequestId+"] end -- "+c.ClassName+"/"+c.MethodName, err.Error())
+// JsonReturn 返回json数据并通过panic提前结束请求 字段名称由配置文件[response]指定
+// 兼容方式 新代码建议使用 return c.Json(...)
+func (c *Con) JsonReturn(code int, data interface{}, format string, a ...interface{}) {
+	err := c.Json(code, data, format, a...)
+	if err != ErrResponded {
+		if c.responded {
+			panic("写入response报错")
+		}
 		panic("json序列化报错")
 	}
-	_, err = c.ResponseWriter.Write(b)
-	if err != nil {
-		mLog.Error("访问记录：["+c.RequestId+"] end -- "+c.ClassName+"/"+c.MethodName, err.Error())
-		panic("写入response报错")
-	}
-
-	if code != 0 {
-		mLog.Info("访问记录：["+c.RequestId+"] end -- "+c.ClassName+"/"+c.MethodName, string(b))
-	}
 
 	panic(JSONRETURN)
 }
@@ -435,25 +568,34 @@ func (c *Con) JsonReturn(code int, data interface{}, format string, a ...interfa
 type checkType int
 
 const (
-	CHECK_INT    checkType = 0
-	CHECK_STRING checkType = 1
+	CHECK_INT          checkType = 0
+	CHECK_STRING       checkType = 1
+	CHECK_FLOAT        checkType = 2
+	CHECK_BOOL         checkType = 3
+	CHECK_DATE         checkType = 4
+	CHECK_ENUM         checkType = 5
+	CHECK_INT_SLICE    checkType = 6
+	CHECK_STRING_SLICE checkType = 7
 )
 
 // CheckField 用于检查数据的结构信息
-// checkType 当前仅支持int64 和 string
+// checkType 支持 int64 string float64 bool 日期 枚举 以及int64 string列表 扩展类型见check.go
 // max = 0 表示不限制长度/大小
-// reg数据校验，多个用|分割
-// 待支持：mobile email ...
+// reg数据校验 仅作用于CHECK_FLOAT与CHECK_STRING_SLICE 可使用预置规则 mobile email idcard url 多个预置规则用|分割
 type CheckField struct {
-	Name    string
-	Dec     string
-	Tpe     checkType
-	Request bool   //是否必填
-	Def     string //默认值
-	Min     int64  //最小值或最小长度
-	Max     int64  //最大值或最大长度
-	Yewu    bool   //是否为业务参数
-	Reg     string //正则规则校验
+	Name     string
+	Dec      string
+	Tpe      checkType
+	Request  bool     //是否必填
+	Def      string   //默认值
+	Min      int64    //最小值或最小长度
+	Max      int64    //最大值或最大长度
+	Yewu     bool     //是否为业务参数
+	Reg      string   //正则规则校验
+	Format   string   //日期格式 默认2006-01-02
+	Enum     []string //枚举的可选值
+	MinFloat float64  //CHECK_FLOAT的最小值 与MaxFloat均为0时不限制
+	MaxFloat float64  //CHECK_FLOAT的最大值 只限制最小值时可设为math.Inf(1)
 }
 
 // CheckField 批量检查参数是否合法
@@ -466,24 +608,21 @@ func (c *Con) CheckField(fields []*CheckField) (map[string]interface{}, error) {
 	var tmp interface{}
 	var err error
 	for _, v := range fields {
-		if v.Yewu {
-			switch v.Tpe {
-			case CHECK_INT:
+		switch v.Tpe {
+		case CHECK_INT:
+			if v.Yewu {
 				tmp, err = c.YewuParamInt(v.Name, v.Dec, v.Request, v.Min, v.Max, v.Def)
-			case CHECK_STRING:
-				tmp, err = c.YewuParamString(v.Name, v.Dec, v.Request, v.Min, v.Max, v.Def)
-			default:
-				return nil, errors.New("暂不支持的数据类型检测")
-			}
-		} else {
-			switch v.Tpe {
-			case CHECK_INT:
+			} else {
 				tmp, err = c.CheckParamInt(v.Name, v.Dec, v.Request, v.Min, v.Max, v.Def)
-			case CHECK_STRING:
+			}
+		case CHECK_STRING:
+			if v.Yewu {
+				tmp, err = c.YewuParamString(v.Name, v.Dec, v.Request, v.Min, v.Max, v.Def)
+			} else {
 				tmp, err = c.CheckParamString(v.Name, v.Dec, v.Request, v.Min, v.Max, v.Def)
-			default:
-				return nil, errors.New("暂不支持的数据类型检测")
 			}
+		default:
+			tmp, err = c.checkExtra(v)
 		}
 
 		if err != nil {
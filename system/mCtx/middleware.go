@@ -0,0 +1,35 @@
+package mCtx
+
+// HandlerFunc 请求处理函数 最内层为控制器方法的调用
+type HandlerFunc func(c *Con)
+
+// Middleware 中间件 包装下一个处理函数 不调用next则中断后续处理
+//
+//	func Cost(next mCtx.HandlerFunc) mCtx.HandlerFunc {
+//		return func(c *mCtx.Con) {
+//			start := time.Now()
+//			next(c)
+//			mLog.Info(c.ClassName, c.MethodName, time.Since(start))
+//		}
+//	}
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain 按顺序组合中间件 第一个中间件位于最外层
+// 调用Abort后 即使调用next也不再执行后续中间件与控制器方法
+func Chain(h HandlerFunc, mws ...Middleware) HandlerFunc {
+	h = abortable(h)
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = abortable(mws[i](h))
+	}
+
+	return h
+}
+
+func abortable(h HandlerFunc) HandlerFunc {
+	return func(c *Con) {
+		if c.IsAborted() {
+			return
+		}
+		h(c)
+	}
+}
@@ -0,0 +1,45 @@
+package mCtx
+
+import (
+	"crypto/x509"
+	"github.com/solaa51/zoo/system/config"
+	"net/http"
+)
+
+/**
+mTLS 客户端证书
+	配置[http] clientCa clientAuth开启 握手时由tls校验证书链
+	c.ClientCert 校验通过的客户端证书 c.ClientSubject 证书的Subject 如 CN=order,O=zoo
+	clientAuth为optional时 ignoreMtlsCheck以外的class必须提供证书 与ignoreIpCheck用法一致
+	仅作用于配置了mTLS的https服务 http端口以及AddServer添加的服务不要求证书
+*/
+
+// ClientCert 返回tls握手时校验通过的客户端证书 没有则返回nil
+func ClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// ClientCertPass 检查请求是否满足class的客户端证书要求
+// 只校验开启了mTLS的https服务上的请求 http端口以及AddServer添加的服务不校验
+func ClientCertPass(r *http.Request, className string) bool {
+	if r.TLS == nil || !MtlsFrom(r.Context()) || !config.ClientCertCheck(className) {
+		return true
+	}
+
+	return ClientCert(r) != nil
+}
+
+// 记录客户端证书
+func (c *Con) setClientCert() {
+	cert := ClientCert(c.Request)
+	if cert == nil {
+		return
+	}
+
+	c.ClientCert = cert
+	c.ClientSubject = cert.Subject.String()
+}
@@ -0,0 +1,52 @@
+package mCtx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientCertPass(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "order", Organization: []string{"zoo"}}}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	cases := []struct {
+		name  string
+		tls   *tls.ConnectionState
+		mtls  bool
+		class string
+		want  bool
+	}{
+		{"http", nil, true, "order", true},
+		{"https without mtls", &tls.ConnectionState{}, false, "order", true},
+		{"ignored class", &tls.ConnectionState{}, true, "public", true},
+		{"missing cert", &tls.ConnectionState{}, true, "order", false},
+		{"unverified cert", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, true, "order", false},
+		{"verified cert", verified, true, "order", true},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/order/create", nil)
+		r.TLS = c.tls
+		if c.mtls {
+			r = r.WithContext(context.WithValue(r.Context(), MtlsKey, true))
+		}
+		if got := ClientCertPass(r, c.class); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "order", Organization: []string{"zoo"}}}
+	c, _ := renderCon("")
+	c.Request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	c.setClientCert()
+	if c.ClientCert != cert || c.ClientSubject != "CN=order,O=zoo" {
+		t.Errorf("got %v %q", c.ClientCert, c.ClientSubject)
+	}
+}
@@ -0,0 +1,517 @@
+package mCtx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/solaa51/zoo/system/cFunc"
+	"github.com/solaa51/zoo/system/config"
+	"github.com/solaa51/zoo/system/mLog"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+返回数据渲染
+	Render 按Accept header选择json xml等格式 返回{msg ret data}结构 字段名称由配置文件[response]指定
+	RenderE 与Render一致 不使用panic 成功时返回ErrResponded
+	RenderData 按Accept header选择格式 直接返回data
+	Xml Text Html Protobuf File Stream 指定格式返回
+
+	自定义格式 如使用google.golang.org/protobuf
+	mCtx.RegisterRenderer("application/x-protobuf", func(w io.Writer, v interface{}) error {
+		b, err := proto.Marshal(v.(proto.Message))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}, false)
+*/
+
+// Renderer 将数据序列化后写入w
+type Renderer func(w io.Writer, v interface{}) error
+
+// ProtoMarshaler protobuf生成的结构体 未注册自定义protobuf渲染时使用
+type ProtoMarshaler interface {
+	Marshal() ([]byte, error)
+}
+
+type renderer struct {
+	contentType string
+	render      Renderer
+	envelope    bool //Render时是否包装为{msg ret data}结构
+}
+
+var (
+	renderMu  sync.RWMutex
+	renderers = []*renderer{ //第一个为默认格式
+		{contentType: "application/json", render: jsonRender, envelope: true},
+		{contentType: "application/xml", render: xmlRender, envelope: true},
+		{contentType: "text/plain", render: textRender},
+		{contentType: "application/x-protobuf", render: protoRender},
+	}
+)
+
+// RegisterRenderer 注册或替换指定Content-Type的渲染方式
+// envelope为true时Render会将数据包装为{msg ret data}结构
+func RegisterRenderer(contentType string, r Renderer, envelope bool) {
+	renderMu.Lock()
+	defer renderMu.Unlock()
+
+	for _, v := range renderers {
+		if v.contentType == contentType {
+			v.render, v.envelope = r, envelope
+			return
+		}
+	}
+
+	renderers = append(renderers, &renderer{contentType: contentType, render: r, envelope: envelope})
+}
+
+func getRenderer(contentType string) *renderer {
+	renderMu.RLock()
+	defer renderMu.RUnlock()
+
+	for _, v := range renderers {
+		if v.contentType == contentType {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func jsonRender(w io.Writer, v interface{}) error {
+	b, err := jsoniter.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func xmlRender(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	//{msg ret data}结构中的data可能为map
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		if _, ok := envelopeSet.Load(rv.Elem().Type()); ok {
+			if f := rv.Elem().Field(3); !f.IsNil() {
+				f.Set(reflect.ValueOf(xmlValue{v: f.Interface()}))
+			}
+		}
+	}
+
+	e := xml.NewEncoder(w)
+	if k := reflect.Indirect(rv).Kind(); k == reflect.Map {
+		return e.EncodeElement(xmlValue{v: v}, xml.StartElement{Name: xml.Name{Local: "response"}})
+	}
+
+	return e.Encode(v)
+}
+
+// xmlValue encoding/xml不支持map 按key排序后输出为子元素 key不是合法的元素名时输出为<item key="">
+// slice中的map同样处理 struct中的map仍不支持 序列化失败时返回500
+type xmlValue struct {
+	v interface{}
+}
+
+func (x xmlValue) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	v := reflect.ValueOf(x.v)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = fmt.Sprint(k.Interface())
+		}
+		sort.Sort(keySorter{names: names, keys: keys})
+
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for i, k := range keys {
+			el := xml.StartElement{Name: xml.Name{Local: names[i]}}
+			if !xmlName.MatchString(names[i]) {
+				el = xml.StartElement{Name: xml.Name{Local: "item"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: names[i]}}}
+			}
+			if err := e.EncodeElement(xmlValue{v: v.MapIndex(k).Interface()}, el); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return e.EncodeElement(v.Interface(), start)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := e.EncodeElement(xmlValue{v: v.Index(i).Interface()}, start); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return e.EncodeElement(v.Interface(), start)
+	}
+}
+
+// 合法的xml元素名 不包含命名空间
+var xmlName = regexp.MustCompile(`^[A-Za-z_][\w.-]*$`)
+
+// map的key按字符串排序
+type keySorter struct {
+	names []string
+	keys  []reflect.Value
+}
+
+func (s keySorter) Len() int           { return len(s.names) }
+func (s keySorter) Less(i, j int) bool { return s.names[i] < s.names[j] }
+func (s keySorter) Swap(i, j int) {
+	s.names[i], s.names[j] = s.names[j], s.names[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+func textRender(w io.Writer, v interface{}) error {
+	_, err := fmt.Fprint(w, v)
+	return err
+}
+
+func protoRender(w io.Writer, v interface{}) error {
+	m, ok := v.(ProtoMarshaler)
+	if !ok {
+		return errors.New("数据未实现Marshal 请通过RegisterRenderer注册protobuf渲染")
+	}
+
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Negotiate 根据Accept header 从offers中选择返回格式 offers为空时从已注册的格式中选择
+// 没有匹配项时返回第一个 即默认的application/json
+func (c *Con) Negotiate(offers ...string) string {
+	if len(offers) == 0 {
+		renderMu.RLock()
+		for _, v := range renderers {
+			offers = append(offers, v.contentType)
+		}
+		renderMu.RUnlock()
+	}
+
+	accept := c.Request.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+
+	//按q值从高到低
+	type acceptItem struct {
+		mime string
+		q    float64
+	}
+	items := make([]acceptItem, 0)
+	for _, v := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			q, _ = strconv.ParseFloat(qs, 64)
+		}
+		if q > 0 {
+			items = append(items, acceptItem{mime: mt, q: q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].q > items[j].q })
+
+	for _, item := range items {
+		for _, offer := range offers {
+			if mimeMatch(item.mime, offer) {
+				return offer
+			}
+		}
+	}
+
+	return offers[0]
+}
+
+// Accept中的类型是否匹配 支持*/*与text/*
+func mimeMatch(accept string, offer string) bool {
+	if accept == "*/*" || accept == offer {
+		return true
+	}
+
+	if strings.HasSuffix(accept, "/*") {
+		return strings.HasPrefix(offer, accept[:len(accept)-1])
+	}
+
+	//application/problem+json等
+	if i := strings.Index(accept, "+"); i > 0 {
+		return offer == accept[:strings.Index(accept, "/")+1]+accept[i+1:]
+	}
+
+	return false
+}
+
+// 返回数据的包装结构 字段名称由配置文件指定
+var (
+	envelopeTypes sync.Map //字段名称 => 包装结构的类型
+	envelopeSet   sync.Map //已创建的包装结构类型 xml渲染时识别
+)
+
+func envelope(code int, data interface{}, msg string) interface{} {
+	names := config.Response{Msg: "msg", Ret: "ret", Data: "data"}
+	if cc := config.Info(); cc != nil && cc.Response.Msg != "" {
+		names = cc.Response
+	}
+
+	t, ok := envelopeTypes.Load(names)
+	if !ok {
+		t = reflect.StructOf([]reflect.StructField{
+			{Name: "XMLName", Type: reflect.TypeOf(xml.Name{}), Tag: `json:"-" xml:"response"`},
+			{Name: "Msg", Type: reflect.TypeOf(""), Tag: reflect.StructTag(`json:"` + names.Msg + `" xml:"` + names.Msg + `"`)},
+			{Name: "Ret", Type: reflect.TypeOf(0), Tag: reflect.StructTag(`json:"` + names.Ret + `" xml:"` + names.Ret + `"`)},
+			{Name: "Data", Type: reflect.TypeOf((*interface{})(nil)).Elem(), Tag: reflect.StructTag(`json:"` + names.Data + `" xml:"` + names.Data + `"`)},
+		})
+		envelopeTypes.Store(names, t)
+		envelopeSet.Store(t, true)
+	}
+
+	v := reflect.New(t.(reflect.Type)).Elem()
+	v.Field(1).SetString(msg)
+	v.Field(2).SetInt(int64(code))
+	if data != nil {
+		v.Field(3).Set(reflect.ValueOf(data))
+	}
+
+	return v.Addr().Interface()
+}
+
+// 格式化提示信息
+func formatMsg(format string, a ...interface{}) string {
+	if strings.Contains(format, "%s") || strings.Contains(format, "%d") || strings.Contains(format, "%v") || strings.Contains(format, "%t") {
+		return fmt.Sprintf(format, a...)
+	}
+
+	return format
+}
+
+// 按格式写入数据
+// 先序列化到缓冲 失败时还未写入header 返回500 不会返回不完整的数据
+func (c *Con) write(status int, contentType string, r Renderer, data interface{}) error {
+	c.responded = true
+
+	var buf bytes.Buffer
+	if err := r(&buf, data); err != nil {
+		mLog.Error("访问记录：["+c.RequestId+"] end -- "+c.ClassName+"/"+c.MethodName, err.Error())
+		http.Error(c.ResponseWriter, "请求处理异常", http.StatusInternalServerError)
+		return err
+	}
+
+	header := c.ResponseWriter.Header()
+	if strings.HasPrefix(contentType, "text/") || strings.HasSuffix(contentType, "json") || strings.HasSuffix(contentType, "xml") {
+		header.Set("Content-Type", contentType+";charset=UTF-8")
+	} else {
+		header.Set("Content-Type", contentType)
+	}
+	if status > 0 {
+		c.ResponseWriter.WriteHeader(status)
+	}
+
+	_, err := c.ResponseWriter.Write(buf.Bytes())
+	return err
+}
+
+// Render 按Accept header选择格式 返回{msg ret data}结构 与JsonReturn一致提前结束请求
+// 选中的格式不支持包装时直接返回data
+func (c *Con) Render(code int, data interface{}, format string, a ...interface{}) {
+	_ = c.RenderE(code, data, format, a...) //序列化失败时已返回500
+	panic(JSONRETURN)
+}
+
+// RenderE 与Render一致 不使用panic 成功时返回ErrResponded
+//
+//	return c.Ctx.RenderE(0, data, "")
+func (c *Con) RenderE(code int, data interface{}, format string, a ...interface{}) error {
+	contentType := c.Negotiate()
+	r := getRenderer(contentType)
+	if !r.envelope {
+		if err := c.write(0, contentType, r.render, data); err != nil {
+			return err
+		}
+		return ErrResponded
+	}
+
+	msg := formatMsg(format, a...)
+	result := &Result{Ret: code, Msg: msg, Data: data}
+
+	if s, ok := data.(string); ok && s == "" { //空字符串 替换为空struct
+		data = struct{}{}
+	}
+
+	if err := c.write(0, contentType, r.render, envelope(code, data, msg)); err != nil {
+		return err
+	}
+	c.result = result
+
+	if code != 0 {
+		mLog.Info("访问记录：["+c.RequestId+"] end -- "+c.ClassName+"/"+c.MethodName, code, msg)
+	}
+
+	return ErrResponded
+}
+
+// RenderData 按Accept header选择格式 直接返回data
+func (c *Con) RenderData(status int, data interface{}) error {
+	contentType := c.Negotiate()
+	return c.write(status, contentType, getRenderer(contentType).render, data)
+}
+
+// Xml 返回xml数据
+func (c *Con) Xml(status int, data interface{}) error {
+	return c.write(status, "application/xml", xmlRender, data)
+}
+
+// Text 返回文本数据
+func (c *Con) Text(status int, format string, a ...interface{}) error {
+	return c.write(status, "text/plain", textRender, formatMsg(format, a...))
+}
+
+// Protobuf 返回protobuf数据 可通过RegisterRenderer替换序列化方式
+func (c *Con) Protobuf(status int, data interface{}) error {
+	return c.write(status, "application/x-protobuf", getRenderer("application/x-protobuf").render, data)
+}
+
+// 页面模板
+var (
+	tplMu     sync.RWMutex
+	templates *template.Template
+)
+
+// SetTemplates 设置Html使用的模板
+func SetTemplates(t *template.Template) {
+	tplMu.Lock()
+	templates = t
+	tplMu.Unlock()
+}
+
+// LoadTemplates 加载程序目录下匹配pattern的模板文件 如 "views/*.html"
+func LoadTemplates(pattern string, funcs template.FuncMap) error {
+	t, err := template.New("").Funcs(funcs).ParseGlob(cFunc.GetAppDir() + pattern)
+	if err != nil {
+		return err
+	}
+	SetTemplates(t)
+
+	return nil
+}
+
+// Html 使用模板name渲染页面
+func (c *Con) Html(status int, name string, data interface{}) error {
+	tplMu.RLock()
+	t := templates
+	tplMu.RUnlock()
+	if t == nil {
+		return errors.New("未设置页面模板")
+	}
+
+	return c.write(status, "text/html", func(w io.Writer, v interface{}) error {
+		return t.ExecuteTemplate(w, name, v)
+	}, data)
+}
+
+// File 返回文件下载 name为下载时的文件名 为空则使用原文件名
+func (c *Con) File(filePath string, name string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return errors.New("不能下载目录")
+	}
+
+	if name == "" {
+		name = filepath.Base(filePath)
+	}
+	c.ResponseWriter.Header().Set("Content-Disposition", contentDisposition(name))
+	c.responded = true
+
+	http.ServeContent(c.ResponseWriter, c.Request, name, fi.ModTime(), f)
+
+	return nil
+}
+
+// 下载文件名 兼容中文文件名
+func contentDisposition(name string) string {
+	ascii := strings.Map(func(r rune) rune {
+		if r > 127 || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	return `attachment; filename="` + ascii + `"; filename*=UTF-8''` + url.PathEscape(name)
+}
+
+// Stream 流式返回数据 step返回false或客户端断开时结束 每次调用后立即发送给客户端
+// 第一次发送后不再受handler的超时时间与http.Server的WriteTimeout限制
+func (c *Con) Stream(contentType string, step func(w io.Writer) bool) error {
+	header := c.ResponseWriter.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	c.responded = true
+
+	//长连接不受http.Server的WriteTimeout限制
+	c.clearWriteDeadline()
+
+	flusher, _ := c.ResponseWriter.(http.Flusher)
+	for {
+		select {
+		case <-c.Done():
+			return c.Err()
+		default:
+		}
+
+		next := step(c.ResponseWriter)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !next {
+			return nil
+		}
+	}
+}
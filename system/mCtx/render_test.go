@@ -0,0 +1,197 @@
+package mCtx
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func renderCon(accept string) (*Con, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+
+	return &Con{Request: r, ResponseWriter: w}, w
+}
+
+// 调用Render 捕获提前结束请求的panic
+func render(c *Con, code int, data interface{}, msg string) {
+	defer func() {
+		if e := recover(); e != nil && e != JSONRETURN {
+			panic(e)
+		}
+	}()
+
+	c.Render(code, data, msg)
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		offers []string
+		want   string
+	}{
+		{"", nil, "application/json"},
+		{"*/*", nil, "application/json"},
+		{"application/xml", nil, "application/xml"},
+		{"text/html, application/xml;q=0.9, */*;q=0.8", nil, "application/xml"},
+		{"application/json;q=0.5, text/plain", nil, "text/plain"},
+		{"text/*", nil, "text/plain"},
+		{"application/problem+json", nil, "application/json"},
+		{"application/xml;q=0, image/png", nil, "application/json"},
+		{"text/html", []string{"application/json", "text/html"}, "text/html"},
+		{"image/png", []string{"text/html", "application/json"}, "text/html"},
+	}
+
+	for _, v := range tests {
+		c, _ := renderCon(v.accept)
+		if got := c.Negotiate(v.offers...); got != v.want {
+			t.Errorf("Negotiate(%q, %v) = %s, want %s", v.accept, v.offers, got, v.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		accept      string
+		data        interface{}
+		contentType string
+		body        string
+	}{
+		{"", map[string]int{"id": 1}, "application/json;charset=UTF-8", `{"msg":"ok","ret":0,"data":{"id":1}}`},
+		{"", "", "application/json;charset=UTF-8", `{"msg":"ok","ret":0,"data":{}}`},
+		{"application/xml", map[string]interface{}{"id": 1, "list": []int{1, 2}, "1a": "x"}, "application/xml;charset=UTF-8",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<response><msg>ok</msg><ret>0</ret><data><item key="1a">x</item><id>1</id><list>1</list><list>2</list></data></response>`},
+		//text不包装为{msg ret data}
+		{"text/plain", "hello", "text/plain;charset=UTF-8", "hello"},
+	}
+
+	for _, v := range tests {
+		c, w := renderCon(v.accept)
+		render(c, 0, v.data, "ok")
+		if got := w.Header().Get("Content-Type"); got != v.contentType {
+			t.Errorf("%q: Content-Type = %s", v.accept, got)
+		}
+		if got := w.Body.String(); got != v.body {
+			t.Errorf("%q: body = %s\nwant   %s", v.accept, got, v.body)
+		}
+		if !c.Responded() {
+			t.Errorf("%q: not responded", v.accept)
+		}
+	}
+
+	//包装的结果用于rpc判断ret
+	c, _ := renderCon("")
+	render(c, 1001, "x", "余额不足")
+	if r := c.Result(); r == nil || r.Ret != 1001 || r.Msg != "余额不足" || r.Data != "x" {
+		t.Errorf("Result = %+v", r)
+	}
+
+	//序列化失败时返回500 不返回不完整的数据
+	c, w := renderCon("application/xml")
+	render(c, 0, struct{ M map[string]int }{M: map[string]int{"a": 1}}, "")
+	if w.Code != http.StatusInternalServerError || c.Result() != nil {
+		t.Errorf("xml error: status = %d result = %v", w.Code, c.Result())
+	}
+}
+
+type protoMsg struct{}
+
+func (protoMsg) Marshal() ([]byte, error) {
+	return []byte{0x08, 0x01}, nil
+}
+
+func TestRenderData(t *testing.T) {
+	c, w := renderCon("application/x-protobuf")
+	if err := c.RenderData(http.StatusCreated, protoMsg{}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != "application/x-protobuf" || w.Body.String() != "\x08\x01" {
+		t.Errorf("protobuf: status = %d header = %v body = %q", w.Code, w.Header(), w.Body.String())
+	}
+
+	c, w = renderCon("application/x-protobuf")
+	if err := c.RenderData(0, "not proto"); err == nil || w.Code != http.StatusInternalServerError {
+		t.Errorf("protobuf error: err = %v status = %d", err, w.Code)
+	}
+
+	//自定义格式
+	RegisterRenderer("application/x-test", func(w io.Writer, v interface{}) error {
+		_, err := io.WriteString(w, "test:"+v.(string))
+		return err
+	}, false)
+	c, w = renderCon("application/x-test")
+	if err := c.RenderData(0, "a"); err != nil || w.Body.String() != "test:a" {
+		t.Errorf("custom: err = %v body = %s", err, w.Body.String())
+	}
+	render(c, 0, "b", "")
+	if w.Body.String() != "test:atest:b" {
+		t.Errorf("custom render: body = %s", w.Body.String())
+	}
+}
+
+func TestTextXmlFile(t *testing.T) {
+	c, w := renderCon("")
+	if err := c.Text(http.StatusAccepted, "id=%d", 5); err != nil || w.Code != http.StatusAccepted || w.Body.String() != "id=5" {
+		t.Errorf("Text: err = %v status = %d body = %s", err, w.Code, w.Body.String())
+	}
+
+	type item struct {
+		Id int `xml:"id"`
+	}
+	c, w = renderCon("")
+	if err := c.Xml(0, item{Id: 1}); err != nil || !strings.HasSuffix(w.Body.String(), "<item><id>1</id></item>") {
+		t.Errorf("Xml: err = %v body = %s", err, w.Body.String())
+	}
+
+	if err := c.Html(0, "index", nil); err == nil {
+		t.Error("Html without templates")
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, w = renderCon("")
+	if err := c.File(file, "报表.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.String() != "content" || w.Header().Get("Content-Disposition") != `attachment; filename="__.txt"; filename*=UTF-8''%E6%8A%A5%E8%A1%A8.txt` {
+		t.Errorf("File: header = %v body = %s", w.Header(), w.Body.String())
+	}
+	if err := c.File(dir, ""); err == nil {
+		t.Error("File accepted a directory")
+	}
+	if err := c.File(filepath.Join(dir, "none"), ""); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("File missing: %v", err)
+	}
+}
+
+func TestRenderE(t *testing.T) {
+	c, w := renderCon("application/xml")
+	if err := c.RenderE(0, map[string]int{"id": 1}, "ok"); err != ErrResponded {
+		t.Fatalf("err = %v", err)
+	}
+	if !strings.HasSuffix(w.Body.String(), "<response><msg>ok</msg><ret>0</ret><data><id>1</id></data></response>") || c.Result() == nil {
+		t.Errorf("body = %s", w.Body.String())
+	}
+
+	c, w = renderCon("text/plain")
+	if err := c.RenderE(1, "plain", ""); err != ErrResponded || w.Body.String() != "plain" {
+		t.Errorf("text: err = %v body = %s", err, w.Body.String())
+	}
+
+	//序列化失败时返回错误 已写入500
+	c, w = renderCon("application/x-protobuf")
+	if err := c.RenderE(0, "not proto", ""); err == nil || err == ErrResponded || w.Code != http.StatusInternalServerError {
+		t.Errorf("error: err = %v status = %d", err, w.Code)
+	}
+}
@@ -0,0 +1,103 @@
+package mCtx
+
+import (
+	"errors"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/solaa51/zoo/system/mLog"
+)
+
+/**
+不使用panic的返回方式
+	控制器方法可返回error 写入返回数据后返回ErrResponded即可结束请求
+	func (w *Welcome) Index() error {
+		if err := w.Ctx.Bind(&req); err != nil {
+			return w.Ctx.Json(400, err, err.Error())
+		}
+		return w.Ctx.Json(0, data, "")
+	}
+
+	返回其他error时 如未写入返回数据 handler记录日志并返回请求处理异常
+
+	中间件或PreInit中调用Abort 之后的中间件与控制器方法均不再执行
+	func Auth(next mCtx.HandlerFunc) mCtx.HandlerFunc {
+		return func(c *mCtx.Con) {
+			if c.Request.Header.Get("token") == "" {
+				_ = c.AbortWithJson(401, "", "未登录")
+				return
+			}
+			next(c)
+		}
+	}
+
+	需要按Accept header选择格式时使用RenderE 同样返回ErrResponded
+		return w.Ctx.RenderE(0, data, "")
+
+	JsonReturn Render仍通过panic提前结束请求 作为兼容方式保留
+*/
+
+// ErrResponded 已写入返回数据 用于结束控制器方法
+var ErrResponded = errors.New("请求已应答")
+
+// Result 通过Json Render返回的{msg ret data}结构
+type Result struct {
+	Ret  int
+	Msg  string
+	Data interface{}
+}
+
+// Result 通过Json Render返回的数据 未返回时为nil
+// json-rpc调用据此将ret不为0的结果作为error返回
+func (c *Con) Result() *Result {
+	return c.result
+}
+
+// Json 返回{msg ret data}结构的json数据 成功时返回ErrResponded
+func (c *Con) Json(code int, data interface{}, format string, a ...interface{}) error {
+	msg := formatMsg(format, a...)
+	result := &Result{Ret: code, Msg: msg, Data: data}
+
+	if s, ok := data.(string); ok && s == "" { //空字符串 替换为空struct
+		data = struct{}{}
+	}
+
+	b, err := jsoniter.Marshal(envelope(code, data, msg))
+	if err != nil {
+		mLog.Error("访问记录：["+c.RequestId+"] end -- "+c.ClassName+"/"+c.MethodName, err.Error())
+		return err
+	}
+
+	c.responded = true
+	c.result = result
+	c.ResponseWriter.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	if _, err = c.ResponseWriter.Write(b); err != nil {
+		mLog.Error("访问记录：["+c.RequestId+"] end -- "+c.ClassName+"/"+c.MethodName, err.Error())
+		return err
+	}
+
+	if code != 0 {
+		mLog.Info("访问记录：["+c.RequestId+"] end -- "+c.ClassName+"/"+c.MethodName, string(b))
+	}
+
+	return ErrResponded
+}
+
+// Responded 是否已写入返回数据
+func (c *Con) Responded() bool {
+	return c.responded
+}
+
+// Abort 中断请求 之后的中间件与控制器方法不再执行
+func (c *Con) Abort() {
+	c.aborted = true
+}
+
+// IsAborted 请求是否已被中断
+func (c *Con) IsAborted() bool {
+	return c.aborted
+}
+
+// AbortWithJson 返回json数据并中断请求
+func (c *Con) AbortWithJson(code int, data interface{}, format string, a ...interface{}) error {
+	c.Abort()
+	return c.Json(code, data, format, a...)
+}
@@ -0,0 +1,132 @@
+package mCtx
+
+import (
+	"errors"
+	"github.com/solaa51/zoo/system/cFunc"
+	"github.com/solaa51/zoo/system/config"
+	"github.com/solaa51/zoo/system/library/nonce"
+	"github.com/solaa51/zoo/system/mLog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	nonceStore nonce.Store //防重放使用的nonce存储
+	nonceOnce  sync.Once
+)
+
+// SetNonceStore 替换防重放使用的nonce存储 多实例部署时可使用共享存储
+// 需在服务启动前调用
+func SetNonceStore(store nonce.Store) {
+	nonceOnce.Do(func() {})
+	nonceStore = store
+}
+
+// 获取nonce存储 未设置时使用内存存储
+func getNonceStore() nonce.Store {
+	nonceOnce.Do(func() {
+		mem := nonce.NewMemory(config.Info().Encrypt.NonceSize)
+		nonceStore = mem
+
+		//配置文件更新时同步容量 已记录的nonce保留
+		config.OnReload(func(c *config.Config) {
+			mem.Resize(c.Encrypt.NonceSize)
+		})
+	})
+
+	return nonceStore
+}
+
+// 检查签名中的时间戳与nonce 防止请求被重放
+// header签名始终检查 param签名在配置encrypt.replayCheck开启时检查
+func replayCheck(p *CommonParam, always bool) error {
+	enc := config.Info().Encrypt
+	if !enc.ReplayCheck && !always {
+		return nil
+	}
+
+	if p.Timestamp == 0 || p.Nonce == "" {
+		return errors.New("timestamp和nonce不能为空")
+	}
+
+	if len(p.Nonce) > 64 {
+		return errors.New("nonce长度不能超过64")
+	}
+
+	skew := enc.TimeSkew
+	if skew <= 0 {
+		skew = 300
+	}
+
+	now := time.Now().Unix()
+	if p.Timestamp < now-skew || p.Timestamp > now+skew {
+		return errors.New("请求已过期")
+	}
+
+	//有效期覆盖整个允许的时间窗口
+	store := getNonceStore()
+	if !store.Check(p.AppKey+":"+p.Nonce, time.Duration(skew*2)*time.Second) {
+		if f, ok := store.(interface{ Full() bool }); ok && f.Full() {
+			return errors.New("请求过多 请稍后再试")
+		}
+		return errors.New("重复的请求")
+	}
+
+	return nil
+}
+
+// HeaderAuth 校验header中携带的签名信息
+// body为请求的原始body数据
+// 请求未携带签名header时返回nil
+func HeaderAuth(r *http.Request, body []byte) (*CommonParam, error) {
+	sign := r.Header.Get(cFunc.HeaderSign)
+	if sign == "" {
+		return nil, nil
+	}
+
+	data := &CommonParam{
+		AppKey: r.Header.Get(cFunc.HeaderAppKey),
+		Ip:     cFunc.ClientIP(r),
+		Sign:   sign,
+	}
+	timestamp := r.Header.Get(cFunc.HeaderTimestamp)
+	data.Nonce = r.Header.Get(cFunc.HeaderNonce)
+
+	if data.AppKey == "" {
+		return nil, errors.New("app_key不能为空")
+	}
+
+	if timestamp == "" {
+		return nil, errors.New("timestamp不能为空")
+	}
+
+	if data.Nonce == "" {
+		return nil, errors.New("nonce不能为空")
+	}
+
+	var err error
+	data.Timestamp, err = strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("timestamp格式错误")
+	}
+
+	key, ok := config.Info().Encrypt.Key(data.AppKey)
+	if !ok {
+		return nil, errors.New("无效的key:" + data.AppKey)
+	}
+
+	str := cFunc.HeaderSignStr(data.AppKey, timestamp, data.Nonce, r.Method, r.URL.Path, r.URL.RawQuery, body)
+	if err = cFunc.VerifyKeySign(data.AppKey, key.Type, key.Value, str, sign); err != nil {
+		mLog.Warn(data.Ip + " - " + r.URL.Path + " header签名错误:" + str + " - " + err.Error())
+		return nil, errors.New("签名错误")
+	}
+
+	if err = replayCheck(data, true); err != nil {
+		mLog.Warn(data.Ip + " - " + r.URL.Path + " - " + err.Error())
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,181 @@
+package mCtx
+
+import (
+	"errors"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+Server-Sent Events 服务端单向推送
+	func (w *Welcome) Events() error {
+		sse, err := w.Ctx.SSE()
+		if err != nil {
+			return err
+		}
+
+		ch := make(chan *mCtx.Event)
+		go produce(w.Ctx, ch) //生产者监听w.Ctx.Done()退出 结束时close(ch)
+		return sse.Stream(ch, 15*time.Second) //阻塞直到ch关闭或客户端断开 空闲时每15秒发送心跳
+	}
+
+	SSE会取消连接的写超时 并停止handler的超时计时 客户端断开时Done()被关闭
+	Last-Event-ID header可通过LastEventId()获取 用于断线重连后续传
+*/
+
+// Event sse事件 Data为字符串时原样发送 其他类型序列化为json
+type Event struct {
+	Id    string
+	Event string
+	Data  interface{}
+	Retry time.Duration //客户端断线重连的间隔
+}
+
+// SSE 推送连接
+type SSE struct {
+	c       *Con
+	flusher http.Flusher
+	mu      sync.Mutex
+}
+
+// SSE 将请求转换为sse推送
+func (c *Con) SSE() (*SSE, error) {
+	flusher, ok := c.ResponseWriter.(http.Flusher)
+	if !ok {
+		return nil, errors.New("当前连接不支持sse")
+	}
+
+	//长连接不受http.Server的WriteTimeout限制
+	c.clearWriteDeadline()
+
+	header := c.ResponseWriter.Header()
+	header.Set("Content-Type", "text/event-stream;charset=UTF-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.ResponseWriter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	c.responded = true
+
+	return &SSE{c: c, flusher: flusher}, nil
+}
+
+// LastEventId 客户端重连时携带的最后一个事件id
+func (s *SSE) LastEventId() string {
+	return s.c.Request.Header.Get("Last-Event-ID")
+}
+
+// Done 客户端断开时关闭
+func (s *SSE) Done() <-chan struct{} {
+	return s.c.Done()
+}
+
+// Send 发送事件
+func (s *SSE) Send(e *Event) error {
+	var b strings.Builder
+	if e.Id != "" {
+		b.WriteString("id: " + oneLine(e.Id) + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + oneLine(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	var data string
+	switch v := e.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		d, err := jsoniter.MarshalToString(v)
+		if err != nil {
+			return err
+		}
+		data = d
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	return s.write(b.String())
+}
+
+// Data 只发送数据
+func (s *SSE) Data(data interface{}) error {
+	return s.Send(&Event{Data: data})
+}
+
+// Comment 发送注释 客户端会忽略 用于心跳保持连接
+func (s *SSE) Comment(text string) error {
+	return s.write(": " + oneLine(text) + "\n\n")
+}
+
+// Stream 持续发送events中的事件 直到events关闭或客户端断开 客户端断开视为正常结束
+// heartbeat大于0时 每隔该时间发送心跳注释
+func (s *SSE) Stream(events <-chan *Event, heartbeat time.Duration) error {
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		t := time.NewTicker(heartbeat)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case <-s.Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(e); err != nil {
+				return s.streamErr(err)
+			}
+		case <-tick:
+			if err := s.Comment("ping"); err != nil {
+				return s.streamErr(err)
+			}
+		}
+	}
+}
+
+// 客户端断开导致的写入失败不视为错误
+func (s *SSE) streamErr(err error) error {
+	if s.c.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+func (s *SSE) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.c.Done():
+		return s.c.Err()
+	default:
+	}
+
+	if _, err := s.c.ResponseWriter.Write([]byte(msg)); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+
+	return nil
+}
+
+// id event等字段不能包含换行
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,128 @@
+package mCtx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSESend(t *testing.T) {
+	c, w := renderCon("")
+	sse, err := c.SSE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = sse.Send(&Event{Id: "1\n2", Event: "msg", Data: "a\r\nb", Retry: 3 * time.Second})
+	_ = sse.Data(map[string]int{"id": 1})
+	_ = sse.Comment("ping")
+
+	want := "id: 1 2\nevent: msg\nretry: 3000\ndata: a\ndata: b\n\n" +
+		"data: {\"id\":1}\n\n" +
+		": ping\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q\nwant   %q", got, want)
+	}
+	if w.Header().Get("Content-Type") != "text/event-stream;charset=UTF-8" || !c.Responded() {
+		t.Errorf("header = %v", w.Header())
+	}
+}
+
+// 推送时间超过http.Server的WriteTimeout 取消写超时后客户端仍能收到全部事件
+func sseServer(http2 bool) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := &Con{Request: r, ResponseWriter: w}
+		sse, err := c.SSE()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ch := make(chan *Event)
+		go func() {
+			defer close(ch)
+			for i := 0; i < 3; i++ {
+				time.Sleep(80 * time.Millisecond)
+				select {
+				case ch <- &Event{Id: strconv.Itoa(i), Data: "e" + strconv.Itoa(i)}:
+				case <-c.Done():
+					return
+				}
+			}
+		}()
+		_ = sse.Stream(ch, 30*time.Millisecond)
+	}))
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Config.ConnContext = WithConn
+
+	if http2 {
+		ts.EnableHTTP2 = true
+		ts.StartTLS()
+	} else {
+		ts.Start()
+	}
+
+	return ts
+}
+
+func TestSSEWriteTimeout(t *testing.T) {
+	for _, http2 := range []bool{false, true} {
+		ts := sseServer(http2)
+
+		resp, err := ts.Client().Get(ts.URL)
+		if err != nil {
+			ts.Close()
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		ts.Close()
+
+		if http2 != (resp.ProtoMajor == 2) {
+			t.Fatalf("proto = %s", resp.Proto)
+		}
+		if err != nil {
+			t.Errorf("%s: read error %v", resp.Proto, err)
+		}
+		body := string(b)
+		if !strings.Contains(body, "id: 2\ndata: e2\n\n") || !strings.Contains(body, ": ping\n\n") {
+			t.Errorf("%s: body = %q", resp.Proto, body)
+		}
+	}
+}
+
+// ResponseWriter的包装通过Unwrap查找SetWriteDeadline
+type unwrapWriter struct {
+	http.ResponseWriter
+}
+
+func (w unwrapWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type deadlineWriter struct {
+	http.ResponseWriter
+	deadline *time.Time
+}
+
+func (w deadlineWriter) SetWriteDeadline(t time.Time) error {
+	*w.deadline = t
+	return nil
+}
+
+func TestSetWriteDeadline(t *testing.T) {
+	var got time.Time
+	want := time.Now()
+	w := unwrapWriter{deadlineWriter{ResponseWriter: httptest.NewRecorder(), deadline: &got}}
+	if err := SetWriteDeadline(w, want); err != nil || !got.Equal(want) {
+		t.Errorf("err = %v deadline = %s", err, got)
+	}
+
+	if err := SetWriteDeadline(unwrapWriter{httptest.NewRecorder()}, want); err != http.ErrNotSupported {
+		t.Errorf("recorder: err = %v", err)
+	}
+}
@@ -33,15 +33,15 @@ func Debug(args ...interface{}) {
 }
 
 func Warn(args ...interface{}) {
-	ll.Warn(args)
+	ll.Warn(args...)
 }
 
 func Info(args ...interface{}) {
-	ll.Info(args)
+	ll.Info(args...)
 }
 
 func Error(args ...interface{}) {
-	ll.Error(args)
+	ll.Error(args...)
 }
 
 func Fatal(args ...interface{}) {
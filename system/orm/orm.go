@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/BurntSushi/toml"
@@ -27,6 +28,17 @@ func GetDb(dbUName string) (*gorm.DB, error) {
 	return nil, errors.New("没找到对应数据库示例")
 }
 
+// GetDbCtx 获取绑定了context的数据库实例 请求取消或超时时sql随之取消
+// ctx可直接传入控制器中的Ctx
+func GetDbCtx(ctx context.Context, dbUName string) (*gorm.DB, error) {
+	db, err := GetDb(dbUName)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.WithContext(ctx), nil
+}
+
 // ShowSql 为数据库连接实例开启sql日志
 func ShowSql(db *gorm.DB) {
 	db.Logger = logger.Default.LogMode(logger.Info)
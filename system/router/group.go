@@ -0,0 +1,199 @@
+package router
+
+import (
+	"github.com/solaa51/zoo/system/mCtx"
+	"strings"
+)
+
+/**
+路由分组 组内规则共享前缀、中间件、默认控制器以及命名空间
+	v2 := router.Group("v2", auth)
+	v2.SetNamespace("v2")                         //组内控制器映射为 v2.xxx 通过handler.AddCompile("v2.user", ...)注册
+	v2.AddCompile(`user/(\d+)`, "user/info/$1")   //v2/user/1 => v2.user/Info(1)
+	admin := v2.Group("admin", adminCheck)        //嵌套分组 前缀为v2/admin 中间件为 auth adminCheck
+	admin.SetDefaultClassMethod("dashboard", "index")
+
+	组内没有规则匹配时 去掉前缀后按 class/method/参数 解析 class加上命名空间
+	目标以/开头时不加命名空间 可映射到组外的控制器
+*/
+
+// RouteGroup 路由分组
+type RouteGroup struct {
+	router            *Router
+	parent            *RouteGroup
+	prefix            string            //完整前缀 包含上级分组
+	namespace         string            //控制器命名空间
+	middleware        []mCtx.Middleware //本分组注册的中间件
+	chain             []mCtx.Middleware //包含上级分组的完整中间件 注册时计算
+	children          []*RouteGroup     //下级分组 中间件变化时同步更新
+	defaultClassName  string            //组内默认控制器
+	defaultMethodName string            //组内默认方法
+}
+
+// Group 创建路由分组
+func Group(prefix string, mws ...mCtx.Middleware) *RouteGroup {
+	return router.Group(prefix, mws...)
+}
+
+// Group 创建路由分组
+func (r *Router) Group(prefix string, mws ...mCtx.Middleware) *RouteGroup {
+	g := &RouteGroup{
+		router:     r,
+		prefix:     strings.Trim(prefix, "/"),
+		middleware: mws,
+	}
+	g.refresh()
+	r.groups = append(r.groups, g)
+
+	return g
+}
+
+// Group 创建嵌套分组 继承上级分组的前缀、中间件与命名空间
+func (g *RouteGroup) Group(prefix string, mws ...mCtx.Middleware) *RouteGroup {
+	child := g.router.Group(g.join(prefix), mws...)
+	child.parent = g
+	child.namespace = g.namespace
+	child.refresh()
+	g.children = append(g.children, child)
+
+	return child
+}
+
+// Use 为分组添加中间件
+func (g *RouteGroup) Use(mws ...mCtx.Middleware) {
+	g.middleware = append(g.middleware, mws...)
+	g.refresh()
+}
+
+// SetNamespace 设置控制器命名空间 组内的class映射为 namespace.class
+func (g *RouteGroup) SetNamespace(namespace string) {
+	g.namespace = namespace
+}
+
+// SetDefaultClassMethod 设置组内默认控制器和默认方法
+func (g *RouteGroup) SetDefaultClassMethod(className, methodName string) {
+	g.defaultClassName = className
+	g.defaultMethodName = methodName
+	g.router.bindClass(g.className(className), g)
+}
+
+// AddCompile 添加组内路由规则 规则自动加上分组前缀 目标class自动加上命名空间
+func (g *RouteGroup) AddCompile(key, value string, methods ...string) {
+	if strings.HasPrefix(value, "/") {
+		value = value[1:]
+	} else {
+		value = g.className(value)
+		g.router.bindClass(strings.SplitN(value, "/", 2)[0], g)
+	}
+
+	g.router.addCompile(g.join(key), value, g, methods)
+}
+
+// Prefix 返回分组的完整前缀
+func (g *RouteGroup) Prefix() string {
+	return g.prefix
+}
+
+// 拼接分组前缀
+func (g *RouteGroup) join(key string) string {
+	key = strings.TrimPrefix(key, "/")
+	if g.prefix == "" {
+		return key
+	}
+	if key == "" {
+		return g.prefix
+	}
+
+	return g.prefix + "/" + key
+}
+
+// 加上命名空间的class
+func (g *RouteGroup) className(className string) string {
+	if g.namespace == "" || className == "" {
+		return className
+	}
+
+	return g.namespace + "." + className
+}
+
+// 按上级到下级的顺序返回分组的中间件 调用方不可修改返回的slice
+func (g *RouteGroup) middlewares() []mCtx.Middleware {
+	if g == nil {
+		return nil
+	}
+
+	return g.chain
+}
+
+// 重新计算分组以及下级分组的中间件 每次生成新的slice 不与上级分组共用底层数组
+func (g *RouteGroup) refresh() {
+	parent := g.parent.middlewares()
+	chain := make([]mCtx.Middleware, 0, len(parent)+len(g.middleware))
+	chain = append(chain, parent...)
+	g.chain = append(chain, g.middleware...)
+
+	for _, c := range g.children {
+		c.refresh()
+	}
+}
+
+// ClassMiddleware 返回class所属分组的中间件 用于不经过路由解析的调用 如json-rpc
+// 组内规则的目标或组内默认控制器为该class时属于最先注册的分组 否则按命名空间取最外层的分组
+// 目标以/开头的组外规则不改变class所属的分组
+func ClassMiddleware(className string) []mCtx.Middleware {
+	return router.ClassMiddleware(className)
+}
+
+// ClassMiddleware 返回class所属分组的中间件
+func (r *Router) ClassMiddleware(className string) []mCtx.Middleware {
+	return r.classGroup(className).middlewares()
+}
+
+// 记录class所属的分组 已存在时保留最先注册的分组
+func (r *Router) bindClass(className string, g *RouteGroup) {
+	if className == "" || strings.ContainsAny(className, "${") {
+		return
+	}
+	if _, ok := r.classGroups[className]; !ok {
+		r.classGroups[className] = g
+	}
+}
+
+// 查找class所属的分组
+func (r *Router) classGroup(className string) *RouteGroup {
+	if g, ok := r.classGroups[className]; ok {
+		return g
+	}
+
+	var group *RouteGroup
+	for _, g := range r.groups {
+		if g.namespace == "" || !strings.HasPrefix(className, g.namespace+".") {
+			continue
+		}
+		if group == nil || len(g.prefix) < len(group.prefix) {
+			group = g
+		}
+	}
+
+	return group
+}
+
+// 查找请求路径所属的分组 多个分组匹配时取前缀最长的
+// 返回分组以及去掉前缀后的路径
+func (r *Router) matchGroup(path string) (*RouteGroup, string) {
+	var group *RouteGroup
+	rest := ""
+	for _, g := range r.groups {
+		if group != nil && len(g.prefix) <= len(group.prefix) {
+			continue
+		}
+
+		if path == g.prefix {
+			group, rest = g, ""
+		} else if strings.HasPrefix(path, g.prefix+"/") {
+			group, rest = g, path[len(g.prefix)+1:]
+		}
+	}
+
+	return group, rest
+}
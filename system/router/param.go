@@ -0,0 +1,220 @@
+package router
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+/**
+命名参数路由
+	router.AddCompile(`user/{id:int}/order/{oid}`, "user/order/{oid}/{id}")
+	目标中的{name}按名称替换为匹配到的值 依次作为控制器方法的参数
+	目标中不包含{name}时 按规则中出现的顺序追加为方法参数
+	匹配到的值同时可通过Ctx.Param("id")获取
+
+	类型 int 整数 / word 字母数字下划线 / alpha 字母 / uuid / path 可包含/的任意字符
+	未指定类型时匹配除/外的任意字符 也可直接写正则 {code:[a-z]{3}}
+*/
+
+// 命名参数的类型对应的正则
+var paramTypes = map[string]string{
+	"int":   `-?\d+`,
+	"word":  `\w+`,
+	"alpha": `[a-zA-Z]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"path":  `.+`,
+}
+
+// 路由规则中是否包含命名参数
+var namedParam = regexp.MustCompile(`\{[a-zA-Z_]\w*(:|\})`)
+
+// 路由规则中的一段 静态文本或命名参数
+type segment struct {
+	static string
+	name   string
+	reg    string
+	match  *regexp.Regexp //校验参数值 反向生成url时使用
+}
+
+// 解析包含命名参数的路由规则
+func parseTemplate(key string) ([]*segment, error) {
+	segs := make([]*segment, 0)
+	for key != "" {
+		i := strings.Index(key, "{")
+		if i < 0 {
+			segs = append(segs, &segment{static: key})
+			break
+		}
+		if i > 0 {
+			segs = append(segs, &segment{static: key[:i]})
+		}
+
+		//查找对应的} 正则中可能包含{}
+		depth, end := 0, -1
+		for j := i; j < len(key); j++ {
+			if key[j] == '{' {
+				depth++
+			} else if key[j] == '}' {
+				depth--
+				if depth == 0 {
+					end = j
+					break
+				}
+			}
+		}
+		if end < 0 {
+			return nil, errors.New("路由规则缺少}:" + key)
+		}
+
+		name, reg := key[i+1:end], `[^/]+`
+		if k := strings.Index(name, ":"); k >= 0 {
+			name, reg = name[:k], name[k+1:]
+			if r, ok := paramTypes[reg]; ok {
+				reg = r
+			}
+		}
+
+		match, err := regexp.Compile(`^(?:` + reg + `)$`)
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, &segment{name: name, reg: reg, match: match})
+
+		key = key[end+1:]
+	}
+
+	return segs, nil
+}
+
+// 将命名参数的路由规则转换为正则 返回参数名称列表
+func templateRegexp(segs []*segment) (string, []string) {
+	var b strings.Builder
+	names := make([]string, 0)
+	for _, v := range segs {
+		if v.name == "" {
+			b.WriteString(regexp.QuoteMeta(v.static))
+			continue
+		}
+		b.WriteString(`(?P<` + v.name + `>` + v.reg + `)`)
+		names = append(names, v.name)
+	}
+
+	return b.String(), names
+}
+
+// 将目标中的{name}替换为参数值 目标中不包含{name}时按顺序追加
+func fillTarget(val string, names []string, values map[string]string) string {
+	if !strings.Contains(val, "{") {
+		for _, n := range names {
+			val += "/" + values[n]
+		}
+		return val
+	}
+
+	for _, n := range names {
+		val = strings.ReplaceAll(val, "{"+n+"}", values[n])
+	}
+
+	return val
+}
+
+// URL 根据class method以及参数 反向生成访问路径
+// 优先使用目标为该class/method的命名参数路由规则 没有则返回默认的/class/method
+// 未在路由规则中使用的参数追加为查询字符串
+func URL(className string, methodName string, params map[string]string) (string, error) {
+	return router.URL(className, methodName, params)
+}
+
+// URL 根据class method以及参数 反向生成访问路径
+func (r *Router) URL(className string, methodName string, params map[string]string) (string, error) {
+	var lastErr error
+	for _, v := range r.compile {
+		if v.segs == nil || !targetIs(v.val, className, methodName) {
+			continue
+		}
+
+		path, used, err := buildPath(v.segs, params)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		return withQuery("/"+path, params, used), nil
+	}
+
+	if lastErr != nil {
+		return "", lastErr
+	}
+
+	if methodName == "" {
+		return withQuery("/"+className, params, nil), nil
+	}
+
+	return withQuery("/"+className+"/"+methodName, params, nil), nil
+}
+
+// 路由规则的目标是否为指定的class/method method首字母不区分大小写
+func targetIs(val string, className string, methodName string) bool {
+	s := strings.Split(val, "/")
+	if len(s) < 2 || s[0] != className || s[1] == "" || methodName == "" {
+		return false
+	}
+
+	r1, n1 := utf8.DecodeRuneInString(s[1])
+	r2, n2 := utf8.DecodeRuneInString(methodName)
+	return strings.EqualFold(string(r1), string(r2)) && s[1][n1:] == methodName[n2:]
+}
+
+// 按路由规则填充参数 返回路径以及使用到的参数名
+func buildPath(segs []*segment, params map[string]string) (string, map[string]bool, error) {
+	var b strings.Builder
+	used := make(map[string]bool, 0)
+	for _, v := range segs {
+		if v.name == "" {
+			b.WriteString(v.static)
+			continue
+		}
+
+		p, ok := params[v.name]
+		if !ok {
+			return "", nil, errors.New("缺少路由参数:" + v.name)
+		}
+		if !v.match.MatchString(p) {
+			return "", nil, errors.New("路由参数格式错误:" + v.name + "=" + p)
+		}
+
+		if v.reg == paramTypes["path"] {
+			b.WriteString(p)
+		} else {
+			b.WriteString(url.PathEscape(p))
+		}
+		used[v.name] = true
+	}
+
+	return b.String(), used, nil
+}
+
+// 将未使用的参数追加为查询字符串
+func withQuery(path string, params map[string]string, used map[string]bool) string {
+	keys := make([]string, 0)
+	for k := range params {
+		if !used[k] {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return path
+	}
+	sort.Strings(keys)
+
+	q := url.Values{}
+	for _, k := range keys {
+		q.Set(k, params[k])
+	}
+
+	return path + "?" + q.Encode()
+}
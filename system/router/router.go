@@ -1,6 +1,7 @@
 package router
 
 import (
+	"github.com/solaa51/zoo/system/mCtx"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -11,39 +12,123 @@ import (
 	可配置自定义路由规则
 	解析出class method params
 	"a/b/(\d+)/(/d+)" = "welcome/index/$1/$2" //welcome-Index($1, $2)
-	routerCheck = router.NewRouter()
+	routerCheck = router.New()
 	routerCheck.SetDefaultClassMethod("welcome", "index")
 	routerCheck.AddCompile(`welcome/(\w+)/(\w+)`, "welcome/index/$1/$2")
 	routerCheck.AddCompile(`welcome/index`, "welcome/index")
 */
 
-// 默认路由
+// 默认路由 包级函数均作用于默认路由
 var router = New()
 
+// Default 返回默认路由
+func Default() *Router {
+	return router
+}
+
+// 目标中按位置替换的参数 $1 $2 ... $10
+var positional = regexp.MustCompile(`\$\d+`)
+
 type regRule struct {
-	key string
-	val string
+	key     string
+	val     string
+	index   int            //注册顺序 多个规则匹配时靠前的优先
+	reg     *regexp.Regexp //注册时编译的正则
+	prefix  string         //规则开头的静态文本
+	static  bool           //规则不包含正则 直接比较字符串
+	methods []string       //允许的http请求方式 为空则不限制
+	segs    []*segment     //命名参数路由规则的解析结果
+	names   []string       //命名参数名称 按规则中出现的顺序
+	group   *RouteGroup    //规则所属的分组
+}
+
+// Route 路由解析结果
+type Route struct {
+	ClassName  string
+	MethodName string
+	Params     []string
+	Named      map[string]string //命名参数
+	Methods    []string          //匹配到的规则允许的http请求方式 为空则不限制 OPTIONS请求时为全部匹配规则的并集
+	Middleware []mCtx.Middleware //所属分组的中间件
+
+	MethodNotAllowed bool //有规则匹配路径 但都不允许该请求方式 Methods为这些规则允许的请求方式
 }
 
 // Router 路由规则设置
 type Router struct {
-	compile           []*regRule //路由正则规则
-	defaultClassName  string     //默认控制器
-	defaultMethodName string     //默认方法
+	compile           []*regRule             //路由正则规则
+	tree              *node                  //按规则静态前缀建立的基数树
+	groups            []*RouteGroup          //路由分组
+	classGroups       map[string]*RouteGroup //组内规则目标class所属的分组
+	defaultClassName  string                 //默认控制器
+	defaultMethodName string                 //默认方法
 }
 
+// New 创建独立的路由 可通过handler的SetRouter使用
 func New() *Router {
 	return &Router{
-		compile: make([]*regRule, 0),
+		compile:     make([]*regRule, 0),
+		tree:        &node{},
+		classGroups: make(map[string]*RouteGroup, 0),
 	}
 }
 
 // AddCompile 设置路由规则
-func AddCompile(key, value string) {
-	router.compile = append(router.compile, &regRule{
-		key: key,
-		val: value,
-	})
+// 支持正则与$1 $2按位置替换 或{name}命名参数
+// methods 允许的http请求方式 如GET POST 不传则不限制
+func AddCompile(key, value string, methods ...string) {
+	router.AddCompile(key, value, methods...)
+}
+
+// AddCompile 设置路由规则
+func (r *Router) AddCompile(key, value string, methods ...string) {
+	r.addCompile(key, value, nil, methods)
+}
+
+// 解析命名参数后添加规则
+func (r *Router) addCompile(key, value string, group *RouteGroup, methods []string) {
+	rule := &regRule{
+		key:     key,
+		val:     value,
+		methods: upperMethods(methods),
+		group:   group,
+	}
+
+	if namedParam.MatchString(key) {
+		segs, err := parseTemplate(key)
+		if err != nil {
+			panic("路由规则错误:" + err.Error())
+		}
+		rule.segs = segs
+		rule.key, rule.names = templateRegexp(segs)
+	}
+
+	r.add(rule)
+}
+
+// 编译规则并加入基数树 规则错误时直接panic 在启动阶段暴露问题
+func (r *Router) add(rule *regRule) {
+	expr := `^` + rule.key + `$`
+	rule.reg = regexp.MustCompile(expr)
+	rule.prefix, rule.static = literalPrefix(expr)
+	rule.index = len(r.compile)
+
+	r.compile = append(r.compile, rule)
+	r.tree.insert(rule.prefix, rule)
+}
+
+// 请求方式统一转为大写
+func upperMethods(methods []string) []string {
+	if len(methods) == 0 {
+		return nil
+	}
+
+	ms := make([]string, 0, len(methods))
+	for _, v := range methods {
+		ms = append(ms, strings.ToUpper(strings.TrimSpace(v)))
+	}
+
+	return ms
 }
 
 /*// Compiles 返回路由规则
@@ -53,12 +138,33 @@ func Compiles() map[string]string {
 
 // SetDefaultClassMethod 设置 默认控制器和默认方法
 func SetDefaultClassMethod(className, methodName string) {
-	router.defaultClassName = className
-	router.defaultMethodName = methodName
+	router.SetDefaultClassMethod(className, methodName)
+}
+
+// SetDefaultClassMethod 设置 默认控制器和默认方法
+func (r *Router) SetDefaultClassMethod(className, methodName string) {
+	r.defaultClassName = className
+	r.defaultMethodName = methodName
 }
 
 // ParseRoute 根据路由规则返回 控制器 方法 参数
 func ParseRoute(request *http.Request) (string, string, []string) {
+	return router.ParseRoute(request)
+}
+
+// ParseRoute 根据路由规则返回 控制器 方法 参数
+func (r *Router) ParseRoute(request *http.Request) (string, string, []string) {
+	route := r.Match(request)
+	return route.ClassName, route.MethodName, route.Params
+}
+
+// Match 根据路由规则解析请求 返回包含请求方式限制的解析结果
+func Match(request *http.Request) *Route {
+	return router.Match(request)
+}
+
+// Match 根据路由规则解析请求 返回包含请求方式限制的解析结果
+func (r *Router) Match(request *http.Request) *Route {
 	urlPath := ""
 	if strings.HasSuffix(request.URL.Path, "/") {
 		urlPath = request.URL.Path[0 : len(request.URL.Path)-1]
@@ -74,20 +180,51 @@ func ParseRoute(request *http.Request) (string, string, []string) {
 	className := ""
 	methodName := ""
 	args := make([]string, 0)
+	var methods []string
+	var named map[string]string
+	var group *RouteGroup
+	groupDefault := false //是否使用分组的默认控制器
 
 	//可以用来处理正则匹配路由
-	for _, v := range router.compile {
-		reg := regexp.MustCompile(`^` + v.key + `$`)
-		matchs := reg.FindStringSubmatch(urlPath)
-		if len(matchs) > 0 { //匹配到了
-			urlPath = v.val
-			p := regexp.MustCompile(`\$\d`)
-			b := p.FindAllString(v.val, -1)
-			for _, i := range b {
-				ij, _ := strconv.Atoi(i[1:])
-				urlPath = strings.ReplaceAll(urlPath, i, matchs[ij])
+	v, matchs, allow := r.lookup(urlPath, request.Method)
+	if v == nil && allow != nil { //路径匹配 请求方式不允许
+		return &Route{
+			Params:           args,
+			Methods:          allow,
+			MethodNotAllowed: true,
+		}
+	}
+
+	if v != nil { //匹配到了
+		urlPath = positional.ReplaceAllStringFunc(v.val, func(i string) string {
+			ij, _ := strconv.Atoi(i[1:])
+			if ij < len(matchs) {
+				return matchs[ij]
+			}
+			return i
+		})
+
+		if len(v.names) > 0 {
+			named = make(map[string]string, len(v.names))
+			for k, n := range v.reg.SubexpNames() {
+				if n != "" {
+					named[n] = matchs[k]
+				}
 			}
-			break
+			urlPath = fillTarget(urlPath, v.names, named)
+		}
+
+		methods = v.methods
+		if request.Method == http.MethodOptions {
+			methods = allow
+		}
+		group = v.group
+	} else if g, rest := r.matchGroup(urlPath); g != nil {
+		//分组内没有匹配的规则 按 class/method/参数 解析 class加上命名空间
+		group, groupDefault = g, true
+		urlPath = rest
+		if urlPath != "" {
+			urlPath = g.className(urlPath)
 		}
 	}
 
@@ -110,13 +247,29 @@ func ParseRoute(request *http.Request) (string, string, []string) {
 		}
 	}
 
+	if groupDefault {
+		if className == "" {
+			className = group.className(group.defaultClassName)
+		}
+		if methodName == "" && group.defaultMethodName != "" {
+			methodName = strings.ToUpper(group.defaultMethodName[:1]) + group.defaultMethodName[1:]
+		}
+	}
+
 	if className == "" {
-		className = router.defaultClassName
+		className = r.defaultClassName
 	}
 
-	if methodName == "" {
-		methodName = router.defaultMethodName
+	if methodName == "" && r.defaultMethodName != "" {
+		methodName = strings.ToUpper(r.defaultMethodName[:1]) + r.defaultMethodName[1:]
 	}
 
-	return className, methodName, args
+	return &Route{
+		ClassName:  className,
+		MethodName: methodName,
+		Params:     args,
+		Named:      named,
+		Methods:    methods,
+		Middleware: group.middlewares(),
+	}
 }
@@ -0,0 +1,430 @@
+package router
+
+import (
+	"fmt"
+	"github.com/solaa51/zoo/system/mCtx"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// 原有的实现 每次请求按注册顺序编译并匹配全部规则 作为对比基准
+func oldLookup(r *Router, path string) (*regRule, []string) {
+	for _, v := range r.compile {
+		reg := regexp.MustCompile(`^` + v.key + `$`)
+		if matchs := reg.FindStringSubmatch(path); len(matchs) > 0 {
+			return v, matchs
+		}
+	}
+
+	return nil, nil
+}
+
+// 使用注册时编译的正则 按注册顺序线性匹配
+func linearLookup(r *Router, path string) (*regRule, []string) {
+	for _, v := range r.compile {
+		if matchs := v.reg.FindStringSubmatch(path); len(matchs) > 0 {
+			return v, matchs
+		}
+	}
+
+	return nil, nil
+}
+
+func newRequest(method string, path string) *http.Request {
+	return httptest.NewRequest(method, "/"+path, nil)
+}
+
+// 生成n条静态或正则规则 返回路由以及匹配最后一条规则的请求路径
+func benchRouter(kind string, n int) (*Router, string) {
+	r := New()
+	path := ""
+	for i := 0; i < n; i++ {
+		if kind == "static" {
+			r.AddCompile(fmt.Sprintf("static/path%d/info", i), fmt.Sprintf("c%d/info", i))
+			path = fmt.Sprintf("static/path%d/info", i)
+		} else {
+			r.AddCompile(fmt.Sprintf(`regex/path%d/(\d+)`, i), fmt.Sprintf("c%d/info/$1", i))
+			path = fmt.Sprintf("regex/path%d/123", i)
+		}
+	}
+
+	return r, path
+}
+
+// match为完整的路由解析 tree为基数树查找规则 linear为按注册顺序线性查找 old为原有的每次编译正则的实现
+func BenchmarkMatch(b *testing.B) {
+	for _, kind := range []string{"static", "regex"} {
+		for _, n := range []int{10, 100, 1000} {
+			r, path := benchRouter(kind, n)
+			req := newRequest(http.MethodGet, path)
+
+			b.Run(fmt.Sprintf("%s/%d/match", kind, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					r.Match(req)
+				}
+			})
+
+			b.Run(fmt.Sprintf("%s/%d/tree", kind, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					r.lookup(path, http.MethodGet)
+				}
+			})
+
+			b.Run(fmt.Sprintf("%s/%d/linear", kind, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					linearLookup(r, path)
+				}
+			})
+
+			b.Run(fmt.Sprintf("%s/%d/old", kind, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					oldLookup(r, path)
+				}
+			})
+		}
+	}
+}
+
+// 多个规则均可匹配时 按注册顺序优先 与前缀长短、是否为静态规则无关
+func TestLookupOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules [][2]string
+		path  string
+		want  string
+	}{
+		{
+			name:  "正则在前",
+			rules: [][2]string{{`user/(\d+)`, "user/info/$1"}, {`user/1`, "user/one"}},
+			path:  "user/1",
+			want:  "user/info/1",
+		},
+		{
+			name:  "静态在前",
+			rules: [][2]string{{`user/1`, "user/one"}, {`user/(\d+)`, "user/info/$1"}},
+			path:  "user/1",
+			want:  "user/one",
+		},
+		{
+			name:  "无前缀的规则在前",
+			rules: [][2]string{{`(\w+)/list`, "$1/list"}, {`user/list`, "member/list"}},
+			path:  "user/list",
+			want:  "user/list",
+		},
+		{
+			name:  "短前缀在前",
+			rules: [][2]string{{`a/(\w+)/c`, "x/short/$1"}, {`a/b/(\w+)`, "x/long/$1"}},
+			path:  "a/b/c",
+			want:  "x/short/b",
+		},
+		{
+			name:  "长前缀在前",
+			rules: [][2]string{{`a/b/(\w+)`, "x/long/$1"}, {`a/(\w+)/c`, "x/short/$1"}},
+			path:  "a/b/c",
+			want:  "x/long/c",
+		},
+		{
+			name:  "前缀拆分后的节点",
+			rules: [][2]string{{`ab/(\d+)`, "x/ab/$1"}, {`a(\w+)/1`, "x/a/$1"}, {`abc/1`, "x/abc"}},
+			path:  "abc/1",
+			want:  "x/a/bc",
+		},
+		{
+			name:  "忽略大小写的规则",
+			rules: [][2]string{{`(?i)USER/(\d+)`, "user/info/$1"}, {`user/(\d+)`, "user/detail/$1"}},
+			path:  "user/2",
+			want:  "user/info/2",
+		},
+		{
+			name:  "均不匹配",
+			rules: [][2]string{{`user/(\d+)`, "user/info/$1"}},
+			path:  "user/a",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			for _, v := range tt.rules {
+				r.AddCompile(v[0], v[1])
+			}
+
+			got := ""
+			v, matchs, _ := r.lookup(tt.path, http.MethodGet)
+			if v != nil {
+				got = positional.ReplaceAllStringFunc(v.val, func(i string) string {
+					return matchs[int(i[1]-'0')]
+				})
+			}
+			if got != tt.want {
+				t.Errorf("lookup(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+
+			//与原有的线性匹配结果一致
+			old, _ := oldLookup(r, tt.path)
+			if old != v {
+				t.Errorf("lookup(%q) 与线性匹配结果不一致", tt.path)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	r := New()
+	r.SetDefaultClassMethod("welcome", "index")
+	r.AddCompile(`sum/(\d+)/(\d+)`, "calc/add/$1/$2")
+	r.AddCompile(`user/{id:int}/order/{oid}`, "user/order/{oid}/{id}")
+	r.AddCompile(`file/{name:path}`, "file/get")
+
+	tests := []struct {
+		path   string
+		class  string
+		method string
+		params []string
+		named  map[string]string
+	}{
+		{"", "welcome", "Index", []string{}, nil},
+		{"user", "user", "Index", []string{}, nil},
+		{"user/info/", "user", "Info", []string{}, nil},
+		{"user/info/1/2", "user", "Info", []string{"1", "2"}, nil},
+		{"sum/1/2", "calc", "Add", []string{"1", "2"}, nil},
+		{"user/1/order/ab", "user", "Order", []string{"ab", "1"}, map[string]string{"id": "1", "oid": "ab"}},
+		{"file/a/b.txt", "file", "Get", []string{"a", "b.txt"}, map[string]string{"name": "a/b.txt"}},
+	}
+
+	for _, tt := range tests {
+		route := r.Match(newRequest(http.MethodGet, tt.path))
+		if route.ClassName != tt.class || route.MethodName != tt.method || !reflect.DeepEqual(route.Params, tt.params) {
+			t.Errorf("Match(%q) = %s/%s %v, want %s/%s %v", tt.path, route.ClassName, route.MethodName, route.Params, tt.class, tt.method, tt.params)
+		}
+		if !reflect.DeepEqual(route.Named, tt.named) {
+			t.Errorf("Match(%q) named = %v, want %v", tt.path, route.Named, tt.named)
+		}
+	}
+}
+
+// 同一路径按请求方式注册多个规则
+func TestMatchMethod(t *testing.T) {
+	r := New()
+	r.AddCompile(`user/(\d+)`, "user/info/$1", "GET")
+	r.AddCompile(`user/(\d+)`, "user/update/$1", "put", "PATCH")
+	r.AddCompile(`any/(\d+)`, "any/info/$1")
+	r.AddCompile(`any/(\d+)`, "any/update/$1", "PUT")
+
+	tests := []struct {
+		method   string
+		path     string
+		want     string
+		methods  []string
+		notAllow bool
+	}{
+		{http.MethodGet, "user/1", "Info", []string{"GET"}, false},
+		{http.MethodHead, "user/1", "Info", []string{"GET"}, false},
+		{http.MethodPut, "user/1", "Update", []string{"PUT", "PATCH"}, false},
+		{http.MethodPatch, "user/1", "Update", []string{"PUT", "PATCH"}, false},
+		{http.MethodDelete, "user/1", "", []string{"GET", "PUT", "PATCH"}, true},
+		{http.MethodOptions, "user/1", "Info", []string{"GET", "PUT", "PATCH"}, false},
+		{http.MethodPut, "any/1", "Info", nil, false},
+		{http.MethodOptions, "any/1", "Info", nil, false},
+	}
+
+	for _, tt := range tests {
+		route := r.Match(newRequest(tt.method, tt.path))
+		if route.MethodName != tt.want || route.MethodNotAllowed != tt.notAllow || !reflect.DeepEqual(route.Methods, tt.methods) {
+			t.Errorf("%s %s = %q %v %v, want %q %v %v", tt.method, tt.path, route.MethodName, route.Methods, route.MethodNotAllowed, tt.want, tt.methods, tt.notAllow)
+		}
+	}
+}
+
+// 记录执行顺序的中间件
+func trace(name string) mCtx.Middleware {
+	return func(next mCtx.HandlerFunc) mCtx.HandlerFunc {
+		return func(c *mCtx.Con) {
+			c.RouteParams["trace"] += name
+			next(c)
+		}
+	}
+}
+
+// 依次执行中间件 返回执行顺序
+func runMiddleware(mws []mCtx.Middleware) string {
+	c := &mCtx.Con{RouteParams: map[string]string{}}
+	mCtx.Chain(func(c *mCtx.Con) {}, mws...)(c)
+
+	return c.RouteParams["trace"]
+}
+
+func TestGroup(t *testing.T) {
+	r := New()
+	r.SetDefaultClassMethod("welcome", "index")
+	v2 := r.Group("v2", trace("a"))
+	v2.SetNamespace("v2")
+	v2.SetDefaultClassMethod("home", "index")
+	v2.AddCompile(`u/(\d+)`, "user/info/$1")
+	v2.AddCompile(`w/(\d+)`, "/welcome/info/$1")
+	admin := v2.Group("admin", trace("b"))
+	admin.AddCompile(`o/{id:int}`, "order/info/{id}")
+	admin.Use(trace("c"))
+
+	tests := []struct {
+		path  string
+		class string
+		route string
+		trace string
+	}{
+		{"v2/u/1", "v2.user", "Info", "a"},
+		{"v2/w/1", "welcome", "Info", "a"},
+		{"v2", "v2.home", "Index", "a"},
+		{"v2/news/list/1", "v2.news", "List", "a"},
+		{"v2/admin/o/2", "v2.order", "Info", "abc"},
+		{"v2/admin", "welcome", "Index", "abc"}, //默认控制器不继承
+		{"v2x/news", "v2x", "News", ""},
+		{"news", "news", "Index", ""},
+	}
+
+	for _, tt := range tests {
+		route := r.Match(newRequest(http.MethodGet, tt.path))
+		if route.ClassName != tt.class || route.MethodName != tt.route {
+			t.Errorf("Match(%q) = %s/%s, want %s/%s", tt.path, route.ClassName, route.MethodName, tt.class, tt.route)
+		}
+		if got := runMiddleware(route.Middleware); got != tt.trace {
+			t.Errorf("Match(%q) middleware = %q, want %q", tt.path, got, tt.trace)
+		}
+	}
+
+	//不经过路由解析时 按class查找所属分组
+	classes := map[string]string{
+		"v2.user":  "a",
+		"v2.home":  "a",
+		"v2.order": "abc",
+		"v2.news":  "a",
+		"welcome":  "",
+		"news":     "",
+	}
+	for class, want := range classes {
+		if got := runMiddleware(r.ClassMiddleware(class)); got != want {
+			t.Errorf("ClassMiddleware(%q) = %q, want %q", class, got, want)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	r := New()
+	r.AddCompile(`user/{id:int}/order/{oid}`, "user/order/{oid}/{id}")
+	r.AddCompile(`file/{name:path}`, "file/get")
+
+	tests := []struct {
+		class  string
+		method string
+		params map[string]string
+		want   string
+		err    bool
+	}{
+		{"user", "Order", map[string]string{"id": "1", "oid": "a b"}, "/user/1/order/a%20b", false},
+		{"user", "order", map[string]string{"id": "1", "oid": "2", "x": "y"}, "/user/1/order/2?x=y", false},
+		{"user", "Order", map[string]string{"id": "a", "oid": "2"}, "", true},
+		{"user", "Order", map[string]string{"id": "1"}, "", true},
+		{"file", "Get", map[string]string{"name": "a/b.txt"}, "/file/a/b.txt", false},
+		{"user", "Info", map[string]string{"id": "1"}, "/user/Info?id=1", false},
+		{"user", "", nil, "/user", false},
+		{"", "", nil, "/", false},
+	}
+
+	for _, tt := range tests {
+		got, err := r.URL(tt.class, tt.method, tt.params)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("URL(%q, %q, %v) = %q %v, want %q", tt.class, tt.method, tt.params, got, err, tt.want)
+		}
+	}
+}
+
+func TestTargetIs(t *testing.T) {
+	tests := []struct {
+		val    string
+		class  string
+		method string
+		want   bool
+	}{
+		{"user/info/$1", "user", "Info", true},
+		{"user/info/$1", "user", "info", true},
+		{"user/info", "user", "INFO", false},
+		{"user/info", "member", "Info", false},
+		{"user", "user", "Info", false},
+		{"user/", "user", "Info", false},
+		{"user/info", "user", "", false},
+		{"user/éa", "user", "Éa", true},
+	}
+
+	for _, tt := range tests {
+		if got := targetIs(tt.val, tt.class, tt.method); got != tt.want {
+			t.Errorf("targetIs(%q, %q, %q) = %v, want %v", tt.val, tt.class, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	segs, err := parseTemplate(`code/{c:[a-z]{3}}/{id:int}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr, names := templateRegexp(segs)
+	if !reflect.DeepEqual(names, []string{"c", "id"}) {
+		t.Errorf("names = %v", names)
+	}
+	if !regexp.MustCompile(`^` + expr + `$`).MatchString("code/abc/12") {
+		t.Errorf("%s 未匹配 code/abc/12", expr)
+	}
+
+	if _, err = parseTemplate(`code/{c:[a-z]{3}`); err == nil || !strings.Contains(err.Error(), "缺少}") {
+		t.Errorf("缺少}时应返回错误 %v", err)
+	}
+}
+
+// 同一上级分组下的多个分组 中间件互不影响 上级分组后添加的中间件同步到下级分组
+func TestGroupMiddleware(t *testing.T) {
+	r := New()
+	p := r.Group("p", trace("a"))
+	p.Use(trace("b"))
+	p.Use(trace("c"))
+	c1 := p.Group("c1", trace("x"))
+	c2 := p.Group("c2", trace("y"))
+	c3 := c2.Group("c3", trace("z"))
+
+	tests := []struct {
+		g    *RouteGroup
+		want string
+	}{
+		{p, "abc"},
+		{c1, "abcx"},
+		{c2, "abcy"},
+		{c3, "abcyz"},
+	}
+	//先全部取出再执行 取出的slice不受其他分组影响
+	mws := make([][]mCtx.Middleware, 0, len(tests))
+	for _, tt := range tests {
+		mws = append(mws, tt.g.middlewares())
+	}
+	for k, tt := range tests {
+		if got := runMiddleware(mws[k]); got != tt.want {
+			t.Errorf("%s middleware = %q, want %q", tt.g.Prefix(), got, tt.want)
+		}
+	}
+
+	p.Use(trace("d"))
+	if got := runMiddleware(c3.middlewares()); got != "abcdyz" {
+		t.Errorf("%s middleware = %q, want %q", c3.Prefix(), got, "abcdyz")
+	}
+	if got := runMiddleware(c1.middlewares()); got != "abcdx" {
+		t.Errorf("%s middleware = %q, want %q", c1.Prefix(), got, "abcdx")
+	}
+}
@@ -0,0 +1,186 @@
+package router
+
+import (
+	"net/http"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+/**
+路由规则前缀树
+	规则在注册时编译 并提取正则开头的静态文本作为前缀放入基数树
+	匹配时沿请求路径查找前缀相符的规则 只对这些规则执行正则匹配
+	不包含动态部分的规则直接比较字符串 不执行正则
+	多个规则同时匹配时 按注册顺序优先 跳过不允许该请求方式的规则
+*/
+
+// 基数树节点
+type node struct {
+	path     string
+	children []*node
+	rules    []*regRule //前缀恰好到此节点结束的规则
+}
+
+// 添加规则 prefix为规则的静态前缀
+func (n *node) insert(prefix string, rule *regRule) {
+	for {
+		if prefix == "" {
+			n.rules = append(n.rules, rule)
+			return
+		}
+
+		//查找与prefix有公共前缀的子节点
+		var child *node
+		for _, c := range n.children {
+			if c.path[0] == prefix[0] {
+				child = c
+				break
+			}
+		}
+
+		if child == nil {
+			n.children = append(n.children, &node{path: prefix, rules: []*regRule{rule}})
+			return
+		}
+
+		i := commonPrefix(child.path, prefix)
+		if i < len(child.path) { //拆分子节点
+			split := &node{
+				path:     child.path[i:],
+				children: child.children,
+				rules:    child.rules,
+			}
+			child.path = child.path[:i]
+			child.children = []*node{split}
+			child.rules = nil
+		}
+
+		n, prefix = child, prefix[i:]
+	}
+}
+
+// 沿请求路径收集前缀相符的规则
+func (n *node) collect(path string, list []*regRule) []*regRule {
+	for {
+		list = append(list, n.rules...)
+		if path == "" {
+			return list
+		}
+
+		var next *node
+		for _, c := range n.children {
+			if c.path[0] == path[0] {
+				next = c
+				break
+			}
+		}
+		if next == nil || !strings.HasPrefix(path, next.path) {
+			return list
+		}
+
+		n, path = next, path[len(next.path):]
+	}
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
+
+// 提取正则开头的静态文本 static表示整个规则均为静态文本
+func literalPrefix(expr string) (prefix string, static bool) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	re = re.Simplify()
+
+	if re.Op != syntax.OpConcat || len(re.Sub) == 0 || re.Sub[0].Op != syntax.OpBeginText {
+		return "", false
+	}
+
+	var b strings.Builder
+	subs := re.Sub[1:]
+	for len(subs) > 0 && subs[0].Op == syntax.OpLiteral && subs[0].Flags&syntax.FoldCase == 0 {
+		b.WriteString(string(subs[0].Rune))
+		subs = subs[1:]
+	}
+
+	return b.String(), len(subs) == 1 && subs[0].Op == syntax.OpEndText
+}
+
+// 查找第一个匹配请求路径且允许该请求方式的规则 返回规则以及正则子匹配结果
+// 有规则匹配路径但都不允许该请求方式时 规则为nil 同时返回这些规则允许的请求方式的并集
+// OPTIONS请求取第一个匹配路径的规则 返回全部匹配规则允许的请求方式 有规则不限制时为nil
+func (r *Router) lookup(path string, method string) (*regRule, []string, []string) {
+	list := r.tree.collect(path, make([]*regRule, 0, 8))
+	if len(list) > 1 {
+		sort.Slice(list, func(i, j int) bool { return list[i].index < list[j].index })
+	}
+
+	var first *regRule
+	var firstMatchs []string
+	var allow []string
+	unlimited := false
+	for _, v := range list {
+		var matchs []string
+		if v.static {
+			if v.prefix != path {
+				continue
+			}
+			matchs = []string{path}
+		} else if matchs = v.reg.FindStringSubmatch(path); len(matchs) == 0 {
+			continue
+		}
+
+		if method == http.MethodOptions {
+			if first == nil {
+				first, firstMatchs = v, matchs
+			}
+		} else if allowMethod(v.methods, method) {
+			return v, matchs, nil
+		}
+
+		if len(v.methods) == 0 {
+			unlimited = true
+		}
+		for _, m := range v.methods {
+			if !hasMethod(allow, m) {
+				allow = append(allow, m)
+			}
+		}
+	}
+
+	if first != nil {
+		if unlimited {
+			return first, firstMatchs, nil
+		}
+		return first, firstMatchs, allow
+	}
+
+	return nil, nil, allow
+}
+
+// 规则是否允许该请求方式 未限制时全部允许 允许GET时同时允许HEAD
+func allowMethod(methods []string, method string) bool {
+	if len(methods) == 0 || hasMethod(methods, method) {
+		return true
+	}
+
+	return method == http.MethodHead && hasMethod(methods, http.MethodGet)
+}
+
+func hasMethod(methods []string, method string) bool {
+	for _, v := range methods {
+		if v == method {
+			return true
+		}
+	}
+
+	return false
+}